@@ -0,0 +1,60 @@
+package source
+
+import (
+	"bytes"
+	"errors"
+)
+
+// BannerPattern identifies a banner sent by a server instead of an auth
+// response, such as when the client has been throttled or banned.
+type BannerPattern struct {
+	// Match is the case insensitive text the banner contains.
+	Match string
+
+	// Err is the error returned if the banner is received, typically
+	// ErrRateLimited or ErrBanned.
+	Err error
+}
+
+// DefaultBannerPatterns are the banner patterns used unless overridden by
+// WithBannerPatterns.
+var DefaultBannerPatterns = []BannerPattern{
+	{Match: "too many connections", Err: ErrRateLimited},
+	{Match: "too many login attempts", Err: ErrRateLimited},
+	{Match: "rate limit", Err: ErrRateLimited},
+	{Match: "banned", Err: ErrBanned},
+}
+
+// WithBannerPatterns replaces the patterns used to recognise banners sent by
+// the server instead of an auth response. Patterns are checked in order and
+// the error of the first match is returned, wrapped in a BannerError.
+func WithBannerPatterns(patterns ...BannerPattern) func(*Client) error {
+	return func(c *Client) error {
+		c.banners = patterns
+		return nil
+	}
+}
+
+// banner returns the error of the first banner pattern which body matches, if
+// any.
+func (c *Client) banner(body []byte) error {
+	if len(body) == 0 {
+		return nil
+	}
+
+	lower := bytes.ToLower(body)
+	for _, p := range c.banners {
+		if bytes.Contains(lower, bytes.ToLower([]byte(p.Match))) {
+			return &BannerError{Banner: string(body), Err: p.Err}
+		}
+	}
+
+	return nil
+}
+
+// retryConnect returns true if connecting should be retried after err.
+// Servers which rejected the password or replied with a banner aren't retried.
+func retryConnect(err error) bool {
+	var be *BannerError
+	return !errors.Is(err, ErrAuthFailure) && !errors.As(err, &be)
+}
@@ -0,0 +1,55 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientBanner(t *testing.T) {
+	errCustom := errors.New("custom")
+	tests := []struct {
+		name    string
+		banner  string
+		options []func(*Client) error
+		expect  error
+	}{
+		{"rate-limited", "Too many connections, try again later", nil, ErrRateLimited},
+		{"banned", "You are BANNED from this server", nil, ErrBanned},
+		{"custom", "Go away", []func(*Client) error{WithBannerPatterns(BannerPattern{Match: "go away", Err: errCustom})}, errCustom},
+		{"custom-replaces-defaults", "You are banned", []func(*Client) error{WithBannerPatterns()}, ErrAuthFailure},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerStopped(t)
+			if s == nil {
+				return
+			}
+			s.responses[fmt.Sprintf("%v:%v", auth, testPassword)] = []*pkt{newPkt(responseValue, -1, tc.banner)}
+			s.Start()
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			opts := append([]func(*Client) error{
+				Password(testPassword),
+				Timeout(time.Millisecond * 200),
+				WithConnectRetry(3, time.Second),
+			}, tc.options...)
+
+			start := time.Now()
+			_, err := NewClient(s.Addr, opts...)
+			assert.ErrorIs(t, err, tc.expect)
+			var be *BannerError
+			if tc.expect != ErrAuthFailure && assert.ErrorAs(t, err, &be) {
+				assert.Equal(t, tc.banner, be.Banner)
+			}
+			// Not retried.
+			assert.Less(t, time.Since(start), time.Second)
+		})
+	}
+}
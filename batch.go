@@ -0,0 +1,138 @@
+package source
+
+import (
+	"bufio"
+	"errors"
+)
+
+// WithBatchWriteBuffer sets the size of the write buffer used by ExecBatch,
+// which defaults to the maximum packet size.
+func WithBatchWriteBuffer(size int) func(*Client) error {
+	return func(c *Client) error {
+		c.batchBuf = size
+		return nil
+	}
+}
+
+// ExecBatch executes cmds on the server, pipelining them by writing them all
+// through a buffered writer which is flushed once before the responses are
+// read, reducing the number of writes. The responses are returned in the
+// order of cmds. If an error occurs the responses read before it are returned
+// along with it, and the connection is poisoned if the responses to the
+// following commands remain unread. If a response may have been truncated, see
+// WithTruncationThreshold, all the responses are returned along with
+// ErrPossiblyTruncated wrapped with the first such command.
+//
+// Packets are only written to the connection when the buffer fills or is
+// flushed, so the timeout applies to those writes rather than to each packet.
+// Other methods, such as ExecCmd, write each packet immediately.
+//
+// Aliases and middlewares aren't applied to commands executed by ExecBatch,
+// and it isn't supported by custom transports.
+func (c *Client) ExecBatch(cmds ...*Cmd) ([]string, error) {
+	if c.dryRun {
+		return nil, ErrDryRun
+	}
+
+	bodies := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		body, err := c.encode(cmd.String())
+		if err != nil {
+			return nil, c.execErr(cmd.redacted(), err)
+		}
+		bodies[i] = body
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	resps, err := c.batchLocked(cmds, bodies)
+	if err != nil && len(resps) < len(cmds) {
+		return resps, c.execErr(cmds[len(resps)].redacted(), c.ctxErr(err))
+	}
+
+	return resps, err
+}
+
+// batchLocked executes bodies, the encoded cmds, on the server and returns
+// their responses. The slow command log times each command from the start of
+// the batch until its response is read. If all the responses are read the
+// first ErrPossiblyTruncated is returned wrapped with its command. The caller
+// must hold c.mtx.
+func (c *Client) batchLocked(cmds []*Cmd, bodies []string) ([]string, error) {
+	start := c.now()
+	ids, err := c.writeBatch(bodies)
+	if err != nil {
+		return nil, err
+	}
+	defer c.fixDeadline()()
+
+	var warning error
+	resps := make([]string, 0, len(bodies))
+	for i, id := range ids {
+		resp, err := c.collect(func(onChunk func(body []byte) error) error {
+			return c.commandLocked(id, bodies[i], onChunk, func(onChunk func(body []byte) error) error {
+				return c.read(id, onChunk)
+			})
+		})
+		c.logSlow(cmds[i], start)
+		if errors.Is(err, ErrPossiblyTruncated) {
+			if warning == nil {
+				warning = c.execErr(cmds[i].redacted(), err)
+			}
+		} else if err != nil {
+			if i < len(ids)-1 {
+				// The responses to the following commands remain unread.
+				c.poisoned = true
+			}
+			return resps, err
+		}
+		resps = append(resps, resp)
+	}
+
+	return resps, warning
+}
+
+// writeBatch writes bodies to the server through a buffered writer, returning
+// the ID of each.
+func (c *Client) writeBatch(bodies []string) ([]int32, error) {
+	if !c.tcp() {
+		return nil, ErrUnsupportedTransport
+	} else if err := c.usable(); err != nil {
+		return nil, err
+	}
+	for _, body := range bodies {
+		if c.maxCmd > 0 && len(body) > c.maxCmd {
+			return nil, ErrCommandTooLarge
+		}
+	}
+
+	size := c.batchBuf
+	if size <= 0 {
+		size = maxPkt
+	}
+	c.bw = bufio.NewWriterSize(c.conn, size)
+	defer func() {
+		c.bw = nil
+	}()
+
+	ids := make([]int32, len(bodies))
+	for i, body := range bodies {
+		ids[i] = c.reqID
+		if err := c.write(execCommand, body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.setDeadline(); err != nil {
+		return nil, err
+	}
+
+	if err := c.bw.Flush(); err != nil {
+		// Part of the buffered packets may have been written.
+		c.poisoned = true
+		return nil, err
+	}
+
+	return ids, nil
+}
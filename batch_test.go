@@ -0,0 +1,108 @@
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countWriter counts the writes made to it.
+type countWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (cw *countWriter) Write(b []byte) (int, error) {
+	cw.writes++
+	return cw.Buffer.Write(b)
+}
+
+func TestClientExecBatch(t *testing.T) {
+	for _, multi := range []bool{true, false} {
+		t.Run(fmt.Sprintf("multi-%v", multi), func(t *testing.T) {
+			s := newServer(t)
+			if s == nil {
+				return
+			}
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			sent := &countWriter{}
+			opts := []func(*Client) error{WithWiretap(sent, nil)}
+			if !multi {
+				opts = append(opts, DisableMultiPacket())
+			}
+			c, err := NewClient(s.Addr, opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			resps, err := c.ExecBatch(
+				NewCmd("echo").WithArgs("test me"),
+				NewCmd("invalid"),
+				NewCmd("echo").WithArgs("test me"),
+			)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"test me", fmt.Sprintf("unknown command %v:invalid", execCommand), "test me"}, resps)
+			assert.Equal(t, 1, sent.writes)
+
+			// The connection is still in sync.
+			resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+			assert.NoError(t, err)
+			assert.Equal(t, "test me", resp)
+
+			_, err = c.ExecBatch(NewCmd("echo"), NewCmd("caf\u00e9"))
+			assert.ErrorIs(t, err, ErrNonASCII)
+		})
+	}
+}
+
+func TestClientExecBatchPossiblyTruncated(t *testing.T) {
+	const big = "0123456789"
+
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:big", execCommand)] = []*pkt{newPkt(responseValue, 0, big)}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, DisableMultiPacket(), WithTruncationThreshold(len(big)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resps, err := c.ExecBatch(NewCmd("big"), NewCmd("echo").WithArgs("test me"), NewCmd("big"))
+	assert.ErrorIs(t, err, ErrPossiblyTruncated)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `"big"`)
+	}
+	assert.Equal(t, []string{big, "test me", big}, resps)
+
+	// The connection is still in sync.
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	// Other variants return the response with the warning.
+	resp, err = c.ExecExpectingN(NewCmd("big"), 1)
+	assert.ErrorIs(t, err, ErrPossiblyTruncated)
+	assert.Equal(t, big, resp)
+
+	resp, err = c.ExecAndWait(NewCmd("big"), func(string) bool { return true }, time.Second)
+	assert.ErrorIs(t, err, ErrPossiblyTruncated)
+	assert.Equal(t, big, resp)
+}
@@ -0,0 +1,134 @@
+package source
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// resultCache caches the responses of commands.
+type resultCache struct {
+	ttl      time.Duration
+	commands map[string]struct{}
+	now      func() time.Time
+
+	mtx     sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is a cached response.
+type cacheEntry struct {
+	resp    string
+	expires time.Time
+}
+
+// WithResultCache caches the responses of commands for ttl, so repeat calls
+// within the window return the cached response without contacting the server.
+// commands may be the names of commands, such as status, which match the first
+// field of the command string whether its arguments were added by Cmd.WithArgs
+// or not, or full commands, such as "maps *". Responses are cached by the full
+// command string and errors aren't cached. Use InvalidateCache to discard cached responses early.
+//
+// The cache is added to the middleware chain at the point the option is given,
+// see Use.
+func WithResultCache(ttl time.Duration, commands ...string) func(*Client) error {
+	return func(c *Client) error {
+		c.cache = &resultCache{
+			ttl:      ttl,
+			commands: make(map[string]struct{}, len(commands)),
+			entries:  make(map[string]cacheEntry),
+			now: func() time.Time {
+				return c.now()
+			},
+		}
+		for _, cmd := range commands {
+			c.cache.commands[cmd] = struct{}{}
+		}
+		c.middlewares = append(c.middlewares, c.cache.middleware)
+		return nil
+	}
+}
+
+// InvalidateCache discards the cached responses of cmds, which are full
+// command strings, or all cached responses if none are given.
+func (c *Client) InvalidateCache(cmds ...string) {
+	if c.cache == nil {
+		return
+	}
+
+	c.cache.mtx.Lock()
+	defer c.cache.mtx.Unlock()
+
+	if len(cmds) == 0 {
+		c.cache.entries = make(map[string]cacheEntry)
+		return
+	}
+
+	for _, cmd := range cmds {
+		delete(c.cache.entries, cmd)
+	}
+}
+
+// middleware is the Middleware which serves cached responses.
+func (rc *resultCache) middleware(next ExecFunc) ExecFunc {
+	return func(ctx context.Context, cmd *Cmd) (string, error) {
+		key := cmd.String()
+		if !rc.cacheable(cmd, key) {
+			return next(ctx, cmd)
+		}
+
+		if resp, ok := rc.get(key); ok {
+			return resp, nil
+		}
+
+		resp, err := next(ctx, cmd)
+		if err != nil {
+			return "", err
+		}
+
+		rc.set(key, resp)
+		return resp, nil
+	}
+}
+
+// cacheable returns true if the response of cmd, whose string is key, should
+// be cached.
+func (rc *resultCache) cacheable(cmd *Cmd, key string) bool {
+	if _, ok := rc.commands[key]; ok {
+		return true
+	}
+	_, ok := rc.commands[cmd.name()]
+	return ok
+}
+
+// get returns the unexpired cached response for key, if any. An expired
+// response is deleted.
+func (rc *resultCache) get(key string) (string, bool) {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+
+	e, ok := rc.entries[key]
+	if !ok {
+		return "", false
+	} else if !rc.now().Before(e.expires) {
+		delete(rc.entries, key)
+		return "", false
+	}
+
+	return e.resp, true
+}
+
+// set caches resp for key, deleting any expired responses so commands which
+// aren't repeated don't accumulate.
+func (rc *resultCache) set(key, resp string) {
+	rc.mtx.Lock()
+	defer rc.mtx.Unlock()
+
+	now := rc.now()
+	for k, e := range rc.entries {
+		if !now.Before(e.expires) {
+			delete(rc.entries, k)
+		}
+	}
+	rc.entries[key] = cacheEntry{resp: resp, expires: now.Add(rc.ttl)}
+}
@@ -0,0 +1,66 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithResultCache(t *testing.T) {
+	var calls int
+	count := func(next ExecFunc) ExecFunc {
+		return func(ctx context.Context, cmd *Cmd) (string, error) {
+			calls++
+			resp, err := next(ctx, cmd)
+			return fmt.Sprintf("%v %v", resp, calls), err
+		}
+	}
+
+	clock := newTestClock()
+	c, err := NewClient("127.0.0.1:1", DryRun(), withClock(clock.Now), WithResultCache(time.Minute, "status", "maps *"), Use(count))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	exec := func(cmd *Cmd) string {
+		resp, err := c.ExecCmd(cmd)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	// Cached by name.
+	assert.Equal(t, DryRunPrefix+"status 1", exec(NewCmd("status")))
+	assert.Equal(t, DryRunPrefix+"status 1", exec(NewCmd("status")))
+	assert.True(t, c.cache.cacheable(NewCmd("status players"), "status players"))
+	assert.True(t, c.cache.cacheable(NewCmd("status").WithArgs("players"), "status players"))
+
+	// Cached by full command.
+	assert.Equal(t, DryRunPrefix+"maps * 2", exec(NewCmd("maps").WithArgs("*")))
+	assert.Equal(t, DryRunPrefix+"maps * 2", exec(NewCmd("maps").WithArgs("*")))
+	assert.Equal(t, DryRunPrefix+"maps de_ 3", exec(NewCmd("maps").WithArgs("de_")))
+
+	// Not cached.
+	assert.Equal(t, DryRunPrefix+"users 4", exec(NewCmd("users")))
+	assert.Equal(t, DryRunPrefix+"users 5", exec(NewCmd("users")))
+
+	// Invalidated.
+	c.InvalidateCache("status")
+	assert.Equal(t, DryRunPrefix+"status 6", exec(NewCmd("status")))
+	assert.Equal(t, DryRunPrefix+"maps * 2", exec(NewCmd("maps").WithArgs("*")))
+	c.InvalidateCache()
+	assert.Equal(t, DryRunPrefix+"maps * 7", exec(NewCmd("maps").WithArgs("*")))
+
+	// Expired, the response of maps * is swept when status is cached.
+	clock.Add(time.Minute)
+	assert.Equal(t, DryRunPrefix+"status 8", exec(NewCmd("status")))
+	assert.Len(t, c.cache.entries, 1)
+
+	// Expired responses are deleted when looked up.
+	clock.Add(time.Minute)
+	_, ok := c.cache.get("status")
+	assert.False(t, ok)
+	assert.Empty(t, c.cache.entries)
+}
@@ -6,9 +6,18 @@ package source
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -16,28 +25,152 @@ const (
 	// DefaultPort is the default source RCON port.
 	DefaultPort = 27015
 
+	// network is the network used to connect to servers.
+	network = "tcp"
+
 	// maxPkt is the maximum size of a response packet.
 	maxPkt = 4096
+
+	// DefaultTruncationThreshold is the default size of the body of a single
+	// packet response which is suspected of having been truncated, see
+	// WithTruncationThreshold.
+	DefaultTruncationThreshold = maxPkt
+
+	// authDrainTimeout is the maximum time to wait for the responseValue
+	// packet which some servers send after the authResponse.
+	authDrainTimeout = time.Millisecond * 50
+
+	// DryRunPrefix prefixes the rendered command returned as the response by
+	// clients in dry-run mode.
+	DryRunPrefix = "dry-run: "
 )
 
 var (
 	// DefaultTimeout is the default read / write / dial timeout for Clients.
 	DefaultTimeout = time.Second * 10
 
+	// minecraftFragmentGrace is the time to wait for further fragments of a
+	// response when MinecraftFragmentWorkaround is enabled.
+	minecraftFragmentGrace = time.Millisecond * 100
+
 	// responseBody is the expected response body for the second response reply.
 	responseBody = []byte{0x00, 0x01, 0x00, 0x00}
+
+	// unknownRequest is the prefix of the body some servers reply with instead
+	// of echoing the empty responseValue packet sent by writeMulti.
+	unknownRequest = []byte("Unknown request")
+
+	// unknownCommandPrefixes are the lower case response prefixes used by
+	// servers to report an unknown command.
+	unknownCommandPrefixes = []string{
+		"unknown command",               // Source, Factorio
+		"unknown or incomplete command", // Minecraft
+	}
+)
+
+// DeadlinePolicy determines how the timeout is applied to the packets which
+// make up a command and its response.
+type DeadlinePolicy int
+
+const (
+	// SlidingDeadline applies the timeout to each packet individually, so a
+	// command with a large multi-packet response may take longer than the
+	// timeout in total. This suits servers which send large responses slowly
+	// but steadily. This is the default.
+	SlidingDeadline DeadlinePolicy = iota
+
+	// FixedDeadline applies the timeout to the command as a whole, bounding
+	// the total time taken regardless of the number of packets. This suits
+	// servers with small responses where a predictable latency is important.
+	FixedDeadline
 )
 
 // Client is a source rcon client.
+// Its safe to call the methods of a Client concurrently, commands are executed
+// one at a time.
 type Client struct {
+	stats     Stats // accessed atomically, first for 64-bit alignment
+	cancelled int32 // accessed atomically
+
+	mtx     sync.Mutex
 	conn    net.Conn
+	ctx     context.Context
+	stop    chan struct{}
 	addr    string
+	port    int
 	pwd     string
+	pwds    []string
 	timeout time.Duration
 	reader  *bufio.Reader
 	reqID   int32
-	read    func(expectedID int32) (string, error)
+	multi   bool
+	read    func(expectedID int32, onChunk func(body []byte) error) error
 	write   func(pktType int32, body string) error
+
+	readBuf     int
+	writeBuf    int
+	grace       time.Duration
+	attempts    int
+	retryDelay  time.Duration
+	maxCmd      int
+	policy      DeadlinePolicy
+	deadline    time.Time
+	terminator  TerminatorMatcher
+	idTolerance int
+	unsolicited func(body string)
+	strict      bool
+	logf        func(format string, args ...interface{})
+	now         func() time.Time
+
+	flavour     string
+	autoDetect  bool
+	detected    string
+	unknownCmd  bool
+	dryRun      bool
+	singleNull  bool
+	reauth      time.Duration
+	reauthStop  chan struct{}
+	reauthOnce  sync.Once
+	authErr     error
+	transport   Transport
+	liveness    time.Duration
+	initialID   int32
+	idGen       func() int32
+	truncAt     int
+	slowAfter   time.Duration
+	slowLog     func(cmd string, d time.Duration)
+	maxResp     int
+	partialEOF  bool
+	banners     []BannerPattern
+	connectCtx  context.Context
+	record      *recorder
+	keepalives  bool
+	slog        *slog.Logger
+	decoder     func(body []byte) (string, error)
+	encoder     func(cmd string) ([]byte, error)
+	nonASCII    bool
+	framer      func(body []byte) ([]byte, error)
+	options     []func(c *Client) error
+	label       string
+	lenient     bool
+	cmdTimeout  func(cmd string) time.Duration
+	preamble    func(conn net.Conn) error
+	poisoned    bool
+	tlsConfig   *tls.Config
+	qmtx        sync.Mutex
+	queue       *queue
+	smtx        sync.Mutex
+	sub         *subscription
+	batchBuf    int
+	bw          *bufio.Writer
+	cache       *resultCache
+	tapSent     io.Writer
+	tapReceived io.Writer
+	middlewares []Middleware
+	execFn      ExecFunc
+
+	amtx    sync.RWMutex
+	aliases map[string]*Cmd
 }
 
 // Timeout sets read / write / dial timeout for a source rcon Client.
@@ -52,219 +185,1821 @@ func Timeout(timeout time.Duration) func(*Client) error {
 func Password(pwd string) func(*Client) error {
 	return func(c *Client) error {
 		c.pwd = pwd
+		c.pwds = nil
 		return nil
 	}
 }
 
-// DisableMultiPacket disables multi-packet support, which not all servers support.
-// This is required for Minecraft and Starbound servers.
-func DisableMultiPacket() func(*Client) error {
+// WithPasswords sets the authentication passwords for a source rcon Client.
+// During authentication each password is tried in order until one succeeds,
+// which is useful when rotating passwords across many servers. Note that some
+// servers ban clients after a number of failed authentication attempts.
+func WithPasswords(pwds ...string) func(*Client) error {
 	return func(c *Client) error {
-		c.read = c.readSingle
-		c.write = c.writePkt
+		c.pwd = ""
+		c.pwds = pwds
 		return nil
 	}
 }
 
-// NewClient returns a new source rcon client connected to addr.
-// If addr doesn't include a port the DefaultPort will be used.
-func NewClient(addr string, options ...func(c *Client) error) (c *Client, err error) {
-	c = &Client{timeout: DefaultTimeout, addr: addr}
-	c.read = c.readMulti
-	c.write = c.writeMulti
-	for _, f := range options {
-		if f == nil {
-			return nil, ErrNilOption
-		}
-		if err = f(c); err != nil {
-			return nil, err
+// WithContext sets the base context of a source rcon Client. It's used when
+// connecting and if cancelled the connection is closed, causing commands to
+// fail with an error wrapping the contexts error rather than a connection
+// error, so intentional cancellation can be distinguished from the server
+// dropping the connection.
+func WithContext(ctx context.Context) func(*Client) error {
+	return func(c *Client) error {
+		c.ctx = ctx
+		return nil
+	}
+}
+
+// WithDefaultPort sets the port used by a source rcon Client if the address
+// doesn't include one, overriding DefaultPort.
+func WithDefaultPort(port int) func(*Client) error {
+	return func(c *Client) error {
+		c.port = port
+		return nil
+	}
+}
+
+// WithSocketBuffers sets the size in bytes of the operating systems receive
+// and send buffers for the connection, zero leaves the default. Larger buffers
+// can improve throughput for clients receiving large responses from many
+// servers. The operating system may clamp the requested sizes. It has no
+// effect for connections which aren't TCP.
+func WithSocketBuffers(read, write int) func(*Client) error {
+	return func(c *Client) error {
+		c.readBuf = read
+		c.writeBuf = write
+		return nil
+	}
+}
+
+// WithConnectRetry configures NewClient to make up to attempts connection
+// attempts, waiting delay between each, before giving up. This allows clients
+// to be started alongside a server which isn't yet accepting connections.
+// Authentication failures due to an incorrect password aren't retried. With
+// Open, retries stop once its context is done.
+func WithConnectRetry(attempts int, delay time.Duration) func(*Client) error {
+	return func(c *Client) error {
+		c.attempts = attempts
+		c.retryDelay = delay
+		return nil
+	}
+}
+
+// WithMaxCommandSize sets the maximum size in bytes of a command, commands
+// which exceed it fail with ErrCommandTooLarge without being sent. The default
+// is no limit.
+//
+// Commands aren't split across packets as servers execute each packet as a
+// separate command. The Source RCON protocol limits packets to 4096 bytes, so
+// the largest command a Source server accepts is 4086 bytes; other servers,
+// such as Minecraft, have lower limits.
+func WithMaxCommandSize(n int) func(*Client) error {
+	return func(c *Client) error {
+		c.maxCmd = n
+		return nil
+	}
+}
+
+// WithDeadlinePolicy sets the DeadlinePolicy used when executing commands.
+func WithDeadlinePolicy(policy DeadlinePolicy) func(*Client) error {
+	return func(c *Client) error {
+		c.policy = policy
+		return nil
+	}
+}
+
+// WithTerminatorMatcher sets the TerminatorMatcher used to detect the end of a
+// multi-packet response, replacing DefaultTerminatorMatcher. This allows
+// servers which deviate from the standard behaviour to be supported.
+func WithTerminatorMatcher(m TerminatorMatcher) func(*Client) error {
+	return func(c *Client) error {
+		c.terminator = m
+		return nil
+	}
+}
+
+// WithUnexpectedIDTolerance sets the number of packets with an unexpected ID,
+// such as a late reply to a previous command, which are ignored while reading a
+// response before it's considered malformed. The default is zero.
+func WithUnexpectedIDTolerance(n int) func(*Client) error {
+	return func(c *Client) error {
+		c.idTolerance = n
+		return nil
+	}
+}
+
+// WithUnsolicitedHandler sets a func which is called with the body of each
+// packet with an unexpected ID which arrives while reading a response, such as
+// a chat message or notification pushed by the server, instead of it being
+// counted towards the unexpected ID tolerance, see WithUnexpectedIDTolerance.
+// The read then continues waiting for the response, so servers which mix
+// pushed packets with responses on one connection can be used. handler is
+// called with the client's lock held, so it mustn't call the client.
+func WithUnsolicitedHandler(handler func(body string)) func(*Client) error {
+	return func(c *Client) error {
+		if handler == nil {
+			return ErrNilOption
 		}
+		c.unsolicited = handler
+		return nil
 	}
+}
 
-	if !strings.Contains(c.addr, ":") {
-		c.addr = fmt.Sprintf("%v:%v", c.addr, DefaultPort)
+// WithLogger sets a printf style logger which is used to report recoverable
+// protocol issues, such as ignored packets. By default nothing is logged.
+func WithLogger(logf func(format string, args ...interface{})) func(*Client) error {
+	return func(c *Client) error {
+		c.logf = logf
+		return nil
 	}
+}
 
-	if c.conn, err = net.DialTimeout("tcp", c.addr, c.timeout); err != nil {
-		return nil, err
+// WithResponseDecoder sets the func used to convert the combined body of a
+// response to the string returned by ExecCmd, such as to decode a charset or
+// strip colour codes. An error returned by decoder is returned wrapped. The
+// bodies of partial responses and those passed to callbacks, such as by
+// ExecCallback, aren't decoded. By default the body is converted as is.
+func WithResponseDecoder(decoder func(body []byte) (string, error)) func(*Client) error {
+	return func(c *Client) error {
+		c.decoder = decoder
+		return nil
 	}
+}
 
-	c.reader = bufio.NewReaderSize(c.conn, maxPkt)
+// Latin1Responses makes the client decode responses from ISO-8859-1 (Latin-1)
+// to UTF-8, for servers which send text such as player names in Latin-1. It's
+// a response decoder, so replaces any set by WithResponseDecoder.
+func Latin1Responses() func(*Client) error {
+	return WithResponseDecoder(decodeLatin1)
+}
 
-	if err = c.auth(); err != nil {
-		c.conn.Close() // nolint: errcheck
-		return nil, err
+// decodeLatin1 converts body from ISO-8859-1 to UTF-8. Each byte of Latin-1
+// is the code point of the character it represents.
+func decodeLatin1(body []byte) (string, error) {
+	runes := make([]rune, len(body))
+	for i, b := range body {
+		runes[i] = rune(b)
 	}
 
-	return c, nil
+	return string(runes), nil
 }
 
-// auth authenticates with the server if a password is set, otherwise its a no-op.
-func (c *Client) auth() error {
-	if c.pwd == "" {
+// WithCommandEncoder sets the func used to convert commands to the bytes sent
+// to the server, such as to transcode them from UTF-8 to the single-byte
+// charset expected by the server. Commands aren't checked for non-ASCII
+// characters when it's set, so ErrNonASCII isn't returned. An error returned by
+// encoder is returned wrapped.
+func WithCommandEncoder(encoder func(cmd string) ([]byte, error)) func(*Client) error {
+	return func(c *Client) error {
+		c.encoder = encoder
 		return nil
 	}
+}
 
-	if err := c.writePkt(auth, c.pwd); err != nil {
-		return err
+// Latin1Commands makes the client encode commands from UTF-8 to ISO-8859-1
+// (Latin-1), the counterpart to Latin1Responses. It's a command encoder, so
+// replaces any set by WithCommandEncoder. Commands with characters which
+// Latin-1 can't represent return an error.
+func Latin1Commands() func(*Client) error {
+	return WithCommandEncoder(encodeLatin1)
+}
+
+// encodeLatin1 converts cmd from UTF-8 to ISO-8859-1.
+func encodeLatin1(cmd string) ([]byte, error) {
+	b := make([]byte, 0, len(cmd))
+	for i, r := range cmd {
+		if r > 0xff {
+			return nil, fmt.Errorf("%q at offset %v not in latin-1", r, i)
+		}
+		b = append(b, byte(r))
 	}
 
-	p, err := c.readPkt()
+	return b, nil
+}
+
+// AllowNonASCII disables the check which rejects commands containing
+// non-ASCII characters with ErrNonASCII, so commands are sent as is, such as
+// those with binary arguments added by Cmd.WithRawArg. The server must expect
+// the bytes sent, as many servers mangle or reject them.
+func AllowNonASCII() func(*Client) error {
+	return func(c *Client) error {
+		c.nonASCII = true
+		return nil
+	}
+}
+
+// encode returns body encoded by the command encoder if set, otherwise it
+// validates body unless non-ASCII is allowed.
+func (c *Client) encode(body string) (string, error) {
+	switch {
+	case c.encoder == nil && c.nonASCII:
+		return body, nil
+	case c.encoder == nil:
+		return body, validate(body)
+	}
+
+	b, err := c.encoder(body)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("source: encode command: %w", err)
 	}
 
-	if p.ID != 0 {
-		return ErrAuthFailure
+	return string(b), nil
+}
+
+// WithBodyFramer sets a func which unwraps the body of each response packet
+// before it's used, for non-standard servers which add their own framing, such
+// as a length prefix, inside the body. It's applied to the packets of command
+// responses only, including those passed to callbacks such as by ExecCallback.
+// An error returned by framer is returned wrapped.
+func WithBodyFramer(framer func(body []byte) ([]byte, error)) func(*Client) error {
+	return func(c *Client) error {
+		c.framer = framer
+		return nil
 	}
+}
 
-	// The official spec says we should get a responseValue followed by authResponse
-	// however Minecraft doesn't send the responseValue packet so we deal with that
-	// case too.
-	switch {
-	case p.Type == responseValue:
-		if p, err = c.readPkt(); err != nil {
-			return err
-		}
+// WithLabel sets a human readable name for the server, such as its name in a
+// server list, which is included in errors and log output along with its
+// address, so the activity of many clients can be told apart.
+func WithLabel(name string) func(*Client) error {
+	return func(c *Client) error {
+		c.label = name
+		return nil
+	}
+}
 
-		if p.ID != 0 || p.Type != authResponse {
-			return ErrAuthFailure
-		}
-	case p.Type != authResponse:
-		return ErrAuthFailure
+// Label returns the name set by WithLabel.
+func (c *Client) Label() string {
+	return c.label
+}
+
+// server returns the address of the server prefixed by its label, if set,
+// for use in errors and log output.
+func (c *Client) server() string {
+	if c.label == "" {
+		return c.addr
 	}
+	return fmt.Sprintf("%v (%v)", c.label, c.addr)
+}
 
-	return nil
+// execErr returns err wrapped with the redacted command which caused it, and
+// the label of the server, if set.
+func (c *Client) execErr(cmd string, err error) error {
+	if c.label == "" {
+		return fmt.Errorf("source: exec %q: %w", cmd, err)
+	}
+	return fmt.Errorf("source: %v: exec %q: %w", c.label, cmd, err)
 }
 
-// Exec creates a new Cmd from cmd and calls ExecCmd with it.
-// If cmd contains non-ASCII characters it returns ErrNonASCII.
-func (c *Client) Exec(cmd string) (string, error) {
-	return c.ExecCmd(NewCmd(cmd))
+// WithPreamble sets a func which is called with the connection immediately
+// after it's established, before authenticating, to perform any exchange
+// required before the RCON protocol starts, such as sending the server
+// identifier required by a proxy which multiplexes many servers on one port.
+// It's bounded by the client timeout. The exchange isn't captured by
+// WithWiretap or RecordTo. An error returned by f is returned wrapped.
+func WithPreamble(f func(conn net.Conn) error) func(*Client) error {
+	return func(c *Client) error {
+		c.preamble = f
+		return nil
+	}
 }
 
-// ExecCmd executes cmd on the server and returns the response.
-// If cmd contains non-ASCII characters it returns ErrNonASCII.
-func (c *Client) ExecCmd(cmd *Cmd) (resp string, err error) {
-	body := cmd.String()
+// WithTimeoutForCommand sets a func which returns the timeout for the named
+// command, such as changelevel or save, so slow commands can be given a longer
+// timeout by ExecCmd without every caller setting one. f is called with the
+// first field of the command string, so both Exec("changelevel de_dust2") and
+// ExecCmd(NewCmd("changelevel").WithArgs("de_dust2")) pass changelevel. If it
+// returns zero the client timeout is used. A timeout set by Cmd.WithTimeout
+// takes precedence.
+func WithTimeoutForCommand(f func(cmd string) time.Duration) func(*Client) error {
+	return func(c *Client) error {
+		c.cmdTimeout = f
+		return nil
+	}
+}
 
-	// Validate body is ASCII only
-	for _, r := range body {
-		if r >= 0x80 {
-			return "", ErrNonASCII
-		}
+// LenientEmptyPackets makes the client accept empty packets with a Size of 8,
+// which omit the null terminators, as sent by some servers to terminate
+// responses. By default packets must have a Size of at least 10.
+func LenientEmptyPackets() func(*Client) error {
+	return func(c *Client) error {
+		c.lenient = true
+		return nil
 	}
+}
 
-	expectedID := c.reqID
-	if err = c.write(execCommand, body); err != nil {
-		return "", err
+// DisableMultiPacket disables multi-packet support, which not all servers support.
+// This is required for Minecraft and Starbound servers.
+func DisableMultiPacket() func(*Client) error {
+	return func(c *Client) error {
+		c.setMultiPacket(false)
+		return nil
 	}
+}
 
-	return c.read(expectedID)
+// WithTruncationThreshold sets the size of the body of a single packet
+// response at which it's suspected of having been truncated by the server,
+// which defaults to DefaultTruncationThreshold. In single-packet mode, see
+// DisableMultiPacket, servers may silently truncate responses which don't fit
+// in a packet, so if the body of a response which arrives in one packet is
+// exactly n bytes Exec returns it along with ErrPossiblyTruncated. A threshold
+// of 0 disables the check. It doesn't apply in multi-packet mode.
+func WithTruncationThreshold(n int) func(*Client) error {
+	return func(c *Client) error {
+		c.truncAt = n
+		return nil
+	}
 }
 
-// Close closes the connection to the server.
-func (c *Client) Close() error {
-	return c.conn.Close()
+// WithAlias registers name as a client-side alias for cmd, see RegisterAlias.
+func WithAlias(name string, cmd *Cmd) func(*Client) error {
+	return func(c *Client) error {
+		c.RegisterAlias(name, cmd)
+		return nil
+	}
 }
 
-// readSingle reads a single packet, validates its ID matches expectedID and returns its body.
-func (c *Client) readSingle(expectedID int32) (string, error) {
-	p, err := c.readPkt()
-	if err != nil {
-		return "", err
+// MinecraftFragmentWorkaround works around Minecraft servers incorrectly
+// splitting long responses across multiple packets in single-packet mode.
+// After the first packet of a response is received, the client waits briefly
+// for further packets with the same ID and combines them into the response.
+//
+// This is a heuristic: it adds a short delay to every command, and fragments
+// which arrive after the grace period are treated as packets with an
+// unexpected ID by the next command.
+func MinecraftFragmentWorkaround() func(*Client) error {
+	return WithSinglePacketGrace(minecraftFragmentGrace)
+}
+
+// WithSinglePacketGrace sets the time the client waits, in single-packet mode,
+// for further packets with the same ID as the first packet of a response,
+// which are combined into the response, for servers which occasionally split
+// responses. The wait restarts after each packet. The default is zero, which
+// disables waiting. See MinecraftFragmentWorkaround for the caveats.
+func WithSinglePacketGrace(d time.Duration) func(*Client) error {
+	return func(c *Client) error {
+		c.grace = d
+		return nil
 	}
+}
 
-	if p.ID != expectedID {
-		return "", ErrMalformedResponse(fmt.Sprintf("unexpected packet id %v", p.ID))
+// DetectUnknownCommand enables detection of unknown command responses, causing
+// ExecCmd to return ErrUnknownCommand instead of the response. As the format of
+// these responses varies between servers, detection is best effort.
+func DetectUnknownCommand() func(*Client) error {
+	return func(c *Client) error {
+		c.unknownCmd = true
+		return nil
 	}
+}
 
-	return p.Body(), nil
+// DryRun returns a client which never connects to the server, for testing
+// command building logic. ExecCmd validates and renders commands, running them
+// through any middlewares, and returns the rendered command prefixed with
+// DryRunPrefix as the response. Methods which require a connection return
+// ErrDryRun: ExecBatch, ExecCallback, ExecAndWait, ExecExpectingN,
+// ExecUntilIdle, ExecRawString, ChangePassword, RTT, Ping, WritePacket,
+// ReadPacket, PeekType, SendRaw, ReadRaw, Subscribe, SupportsMultiPacket,
+// Drain and SetNoDelay.
+func DryRun() func(*Client) error {
+	return func(c *Client) error {
+		c.dryRun = true
+		return nil
+	}
 }
 
-// readMulti reads responses packets from the server, combines multi-packet
-// response bodies and returns the result.
-func (c *Client) readMulti(expectedID int32) (body string, err error) {
-	var buf bytes.Buffer
-	var cnt int
-	for {
-		p, err := c.readPkt()
-		if err != nil {
-			return "", err
-		}
-		if p.Type != responseValue {
-			return "", ErrMalformedResponse("unexpected type")
+// SingleNullTerminator makes the client terminate the packets it writes with
+// a single null byte instead of the two required by the spec, for
+// compatibility with server implementations which reject the second.
+func SingleNullTerminator() func(*Client) error {
+	return func(c *Client) error {
+		c.singleNull = true
+		return nil
+	}
+}
+
+// WithLivenessCheck makes the client wait up to d after connecting, before
+// authenticating, for the server to close or reset the connection. If it does
+// NewClient fails fast with ErrBackendDead, rather than waiting for auth to
+// time out, which helps when servers are behind a load balancer which accepts
+// connections for dead backends. This adds up to d to the time taken to
+// connect.
+func WithLivenessCheck(d time.Duration) func(*Client) error {
+	return func(c *Client) error {
+		c.liveness = d
+		return nil
+	}
+}
+
+// WithInitialRequestID sets the ID of the first packet the client sends, and
+// that the request ID is reset to by Reset, which is otherwise 0.
+func WithInitialRequestID(id int32) func(*Client) error {
+	return func(c *Client) error {
+		c.initialID = id
+		c.reqID = id
+		return nil
+	}
+}
+
+// WithRequestIDGenerator makes the client call gen for the ID of each request
+// it sends, instead of incrementing the ID from the initial request ID, so
+// custom schemes such as random or wraparound-safe IDs can be used. It takes
+// precedence over WithInitialRequestID.
+//
+// In multi-packet mode each command is followed by an empty responseValue
+// packet, whose ID is always that of the command plus one rather than one
+// returned by gen, as the reply to it terminates the response. So gen must not
+// return -1, which servers use to reject auth, or an ID such that it or the
+// ID following it is that of another request which may still be in flight, as
+// their replies couldn't be told apart. gen is called with the client's lock
+// held, so it mustn't call the client.
+func WithRequestIDGenerator(gen func() int32) func(*Client) error {
+	return func(c *Client) error {
+		if gen == nil {
+			return ErrNilOption
 		}
+		c.idGen = gen
+		return nil
+	}
+}
 
-		switch p.ID {
-		case expectedID:
-			// Command response packets, one or more expected.
-			if _, err = buf.Write(p.body); err != nil {
-				return "", err
-			}
-		case expectedID + 1:
-			// Response response packets, exactly two expected.
-			cnt++
-			switch cnt {
-			case 1:
-				// Echoed response packet.
-				if len(p.body) != 0 {
-					return "", ErrMalformedResponse("non-empty body")
-				}
-			case 2:
-				// Response packet response.
-				if !bytes.Equal(p.body, responseBody) {
-					return "", ErrMalformedResponse(fmt.Sprintf("unexpected body %q", p.Body()))
-				}
-				return buf.String(), nil
-			}
-		default:
-			return "", ErrMalformedResponse(fmt.Sprintf("unexpected packet id %v", p.ID))
+// WithMaxResponseSize limits the total size of the body of a response to n
+// bytes, protecting against servers which send an unbounded number of response
+// packets. If the limit is exceeded the command returns ErrResponseTooLarge and
+// the remainder of the response is left unread, so the client should be Reset.
+func WithMaxResponseSize(n int) func(*Client) error {
+	return func(c *Client) error {
+		c.maxResp = n
+		return nil
+	}
+}
+
+// ReturnPartialOnEOF makes Exec and ExecCmd return the part of a response
+// received before the server closed the connection, along with a PartialError
+// wrapping io.EOF or io.ErrUnexpectedEOF, so callers can decide whether the
+// partial response is usable. By default only the error is returned.
+func ReturnPartialOnEOF() func(*Client) error {
+	return func(c *Client) error {
+		c.partialEOF = true
+		return nil
+	}
+}
+
+// WithSlowCommandLog makes the client call logf with each command executed by
+// ExecCmd, and so Exec, ExecCallback, ExecExpectingN, ExecUntilIdle or
+// ExecBatch which takes longer than threshold, and how long it took, to
+// surface outliers without logging every command. The time of ExecCmd includes
+// any middlewares, and commands of ExecBatch are timed from the start of the
+// batch until their response is read. Failed commands are included. The
+// arguments of commands which set passwords are redacted.
+func WithSlowCommandLog(threshold time.Duration, logf func(cmd string, d time.Duration)) func(*Client) error {
+	return func(c *Client) error {
+		if logf == nil {
+			return ErrNilOption
 		}
+		c.slowAfter = threshold
+		c.slowLog = logf
+		return nil
 	}
 }
 
-// readPkt reads a single packet from the server and returns it.
-func (c *Client) readPkt() (*pkt, error) {
-	if err := c.setDeadline(); err != nil {
-		return nil, err
+// NewClient returns a new source rcon client connected to addr.
+// If addr doesn't include a port the DefaultPort will be used, unless
+// overridden by WithDefaultPort.
+//
+// Errors connecting to or authenticating with the server are wrapped with the
+// address used, the underlying error can be retrieved with errors.Unwrap.
+func NewClient(addr string, options ...func(c *Client) error) (c *Client, err error) {
+	c = &Client{
+		timeout:    DefaultTimeout,
+		addr:       addr,
+		port:       DefaultPort,
+		terminator: DefaultTerminatorMatcher,
+		banners:    DefaultBannerPatterns,
+		logf:       func(format string, args ...interface{}) {},
+		now:        time.Now,
+		options:    options,
+		truncAt:    DefaultTruncationThreshold,
+	}
+	c.setMultiPacket(true)
+	for _, f := range options {
+		if f == nil {
+			return nil, ErrNilOption
+		}
+		if err = f(c); err != nil {
+			return nil, err
+		}
+	}
+	c.resetID()
+
+	if !strings.Contains(c.addr, ":") {
+		c.addr = fmt.Sprintf("%v:%v", c.addr, c.port)
 	}
 
-	p := &pkt{}
-	if _, err := p.ReadFrom(c.reader); err != nil {
+	if c.transport == nil {
+		c.transport = tcpTransport{c: c}
+	} else if err = c.checkTransport(); err != nil {
 		return nil, err
 	}
 
-	return p, nil
-}
+	c.execFn = c.execCmd
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		c.execFn = c.middlewares[i](c.execFn)
+	}
 
-// writeMulti writes a packet with type t and body followed by a empty body
-// responseValue type packet, so that we can easily decode multi-packet responses.
-// https://developer.valvesoftware.com/wiki/Source_RCON_Protocol#Multiple-packet_Responses
-func (c *Client) writeMulti(pktType int32, body string) error {
-	if err := c.writePkt(pktType, body); err != nil {
-		return err
+	if err = c.connectRetry(); err != nil {
+		return nil, err
 	}
+	c.startReauth()
 
-	// Now send an empty server response packet which will be echoed back, allowing
-	// us to easily determine if we are processing a multi packet response.
-	return c.writePkt(responseValue, "")
+	return c, nil
 }
 
-// writePkt writes a single packet to the server.
-func (c *Client) writePkt(pktType int32, body string) error {
-	p := newPkt(pktType, c.reqID, body)
-	c.reqID++
+// connectRetry connects to the server, retrying as configured by
+// WithConnectRetry. Retries stop once the connect context, see Open, is done.
+func (c *Client) connectRetry() error {
+	for i := 1; ; i++ {
+		err := c.connect()
+		if err == nil || i >= c.attempts || !retryConnect(err) {
+			return err
+		} else if err = c.waitRetry(); err != nil {
+			return err
+		}
+	}
+}
 
-	if err := c.setDeadline(); err != nil {
-		return err
+// waitRetry waits for the delay between attempts to connect, returning the
+// error of the connect context wrapped if it's done first.
+func (c *Client) waitRetry() error {
+	if c.connectCtx == nil {
+		time.Sleep(c.retryDelay)
+		return nil
 	}
 
-	_, err := p.WriteTo(c.conn)
-	return err
+	select {
+	case <-c.connectCtx.Done():
+		return fmt.Errorf("source: connect %v: %w", c.server(), c.connectCtx.Err())
+	case <-time.After(c.retryDelay):
+		return nil
+	}
 }
 
-// setDeadline updates the deadline on the connection based on the clients configured timeout.
-func (c *Client) setDeadline() error {
-	return c.conn.SetDeadline(time.Now().Add(c.timeout))
+// connect connects to the server and authenticates.
+// In dry-run mode its a no-op.
+func (c *Client) connect() (err error) {
+	if c.dryRun {
+		return nil
+	}
+
+	defer func(start time.Time) {
+		c.logConnect(start, err)
+	}(c.now())
+
+	if c.tcp() {
+		if err = c.dial(); err != nil {
+			return err
+		}
+
+		if c.connectCtx != nil {
+			stop := c.watchConnect(c.connectCtx)
+			defer func() {
+				if cerr := stop(); cerr != nil {
+					err = cerr
+				}
+			}()
+		}
+	}
+
+	if err = c.auth(); err != nil {
+		c.closeConn() // nolint: errcheck
+		return c.authFailed(err)
+	}
+
+	if c.autoDetect {
+		if err = c.detectServer(); err != nil {
+			c.closeConn() // nolint: errcheck
+			return fmt.Errorf("source: detect %v: %w", c.server(), c.ctxErr(err))
+		}
+	}
+
+	return nil
+}
+
+// dial establishes the TCP connection to the server.
+func (c *Client) dial() (err error) {
+	ctx := c.ctx
+	if c.connectCtx != nil {
+		ctx = c.connectCtx
+	} else if ctx == nil {
+		ctx = context.Background()
+	}
+
+	d := net.Dialer{Timeout: c.timeout}
+	if c.conn, err = d.DialContext(ctx, network, c.addr); err != nil {
+		return fmt.Errorf("source: dial %v %v: %w", network, c.server(), err)
+	}
+
+	if c.ctx != nil {
+		atomic.StoreInt32(&c.cancelled, 0)
+		c.stop = make(chan struct{})
+		go c.watch(c.conn, c.stop)
+	}
+
+	if err = c.setupConn(ctx); err != nil {
+		c.closeConn() // nolint: errcheck
+		return err
+	}
+	c.wrapConn()
+
+	if c.liveness > 0 {
+		if err = c.checkLiveness(); err != nil {
+			c.closeConn() // nolint: errcheck
+			return fmt.Errorf("source: liveness %v: %w", c.server(), err)
+		}
+	}
+
+	return nil
+}
+
+// setupConn applies the socket buffer sizes, then exchanges the preamble and
+// performs the TLS handshake, if configured, on the newly dialed connection.
+func (c *Client) setupConn(ctx context.Context) error {
+	if err := c.setSocketBuffers(); err != nil {
+		return fmt.Errorf("source: socket buffers %v: %w", c.server(), err)
+	}
+
+	if err := c.sendPreamble(); err != nil {
+		return fmt.Errorf("source: preamble %v: %w", c.server(), err)
+	}
+
+	return c.handshakeTLS(ctx)
+}
+
+// wrapConn wraps the connection to capture the traffic for the wiretap and
+// recording, if configured, and attaches the reader to it.
+func (c *Client) wrapConn() {
+	if c.tapSent != nil || c.tapReceived != nil {
+		c.conn = &tapConn{Conn: c.conn, sent: c.tapSent, received: c.tapReceived}
+	}
+
+	if c.record != nil {
+		c.record.wrap(c)
+	}
+
+	// The size of the reader buffer doesn't cap the size of packets, as bodies
+	// are read through it in as many reads as required.
+	if c.reader == nil {
+		c.reader = bufio.NewReaderSize(c.conn, maxPkt)
+	} else {
+		c.reader.Reset(c.conn)
+	}
+}
+
+// checkLiveness waits briefly for the server to close or reset the connection,
+// returning ErrBackendDead if it does.
+func (c *Client) checkLiveness() error {
+	// Both a timeout and data arriving, which is left for auth to read,
+	// indicate the backend is alive.
+	_, err := c.waitPkt(c.liveness)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, io.EOF), errors.Is(err, syscall.ECONNRESET):
+		return ErrBackendDead
+	}
+
+	return err
+}
+
+// sendPreamble calls the preamble func, if set, with the connection, bounded
+// by the client timeout.
+func (c *Client) sendPreamble() error {
+	if c.preamble == nil {
+		return nil
+	}
+
+	if err := c.conn.SetDeadline(c.now().Add(c.timeout)); err != nil {
+		return err
+	}
+
+	if err := c.preamble(c.conn); err != nil {
+		return err
+	}
+
+	return c.conn.SetDeadline(time.Time{})
+}
+
+// setSocketBuffers applies the configured socket buffer sizes, if any, to the
+// connection if its TCP.
+func (c *Client) setSocketBuffers() error {
+	tc, ok := c.conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if c.readBuf > 0 {
+		if err := tc.SetReadBuffer(c.readBuf); err != nil {
+			return err
+		}
+	}
+
+	if c.writeBuf > 0 {
+		return tc.SetWriteBuffer(c.writeBuf)
+	}
+
+	return nil
+}
+
+// watch closes conn if the clients context is cancelled before stop is closed.
+func (c *Client) watch(conn net.Conn, stop <-chan struct{}) {
+	select {
+	case <-c.ctx.Done():
+		atomic.StoreInt32(&c.cancelled, 1)
+		conn.Close() // nolint: errcheck
+	case <-stop:
+	}
+}
+
+// ctxErr returns the wrapped error of the clients context if it caused the
+// connection to be closed, otherwise err.
+func (c *Client) ctxErr(err error) error {
+	if atomic.LoadInt32(&c.cancelled) == 1 {
+		return fmt.Errorf("source: connection closed: %w", c.ctx.Err())
+	}
+	return err
+}
+
+// usable returns an error if the connection can't be used for commands, due
+// to a failed re-authentication, a malformed response or a partial write.
+func (c *Client) usable() error {
+	if c.authErr != nil {
+		return c.authErr
+	} else if c.poisoned {
+		return ErrConnPoisoned
+	}
+	return nil
+}
+
+// poison marks the connection as poisoned if err indicates a malformed
+// response, as unread parts of it may remain, so they aren't mistaken for the
+// response to the next command.
+func (c *Client) poison(err error) {
+	var malformed ErrMalformedResponse
+	if errors.As(err, &malformed) {
+		c.poisoned = true
+	}
+}
+
+// SetNoDelay controls whether the operating system delays sending packets in
+// the hope of sending fewer, larger ones (Nagle's algorithm). Go disables the
+// delay by default, which suits interactive use, so enabling it around batch
+// writes lets them be coalesced. It applies to the current connection only, a
+// new connection made by Reset or otherwise uses the default. If the client
+// doesn't use a TCP connection it returns ErrUnsupportedTransport.
+func (c *Client) SetNoDelay(noDelay bool) error {
+	if c.dryRun {
+		return ErrDryRun
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	tc, ok := c.tcpConn()
+	if !ok {
+		return ErrUnsupportedTransport
+	}
+
+	return tc.SetNoDelay(noDelay)
+}
+
+// tcpConn returns the underlying TCP connection, if any.
+func (c *Client) tcpConn() (*net.TCPConn, bool) {
+	if !c.tcp() {
+		return nil, false
+	}
+
+	conn := c.conn
+	for {
+		switch tc := conn.(type) {
+		case *net.TCPConn:
+			return tc, true
+		case *tapConn:
+			conn = tc.Conn
+		case *tls.Conn:
+			conn = tc.NetConn()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// closeConn stops watching the connection and closes it.
+func (c *Client) closeConn() error {
+	return c.transport.Close()
+}
+
+// Reset closes the connection to the server then reconnects and authenticates
+// with the same options, resetting the request ID to its initial value. This
+// allows a Client to be reused across many connections without allocating a
+// new one.
+func (c *Client) Reset() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.reconnect()
+}
+
+// reconnect closes the connection to the server then reconnects and
+// authenticates. The caller must hold c.mtx.
+func (c *Client) reconnect() error {
+	if !c.tcp() {
+		return ErrUnsupportedTransport
+	}
+
+	c.closeConn() // nolint: errcheck
+	c.resetID()
+	c.authErr = nil
+	c.poisoned = false
+
+	return c.connect()
+}
+
+// TerminatorMatcher is called for each packet received in reply to the empty
+// responseValue packet sent after a command in multi-packet mode. It returns
+// done if p marks the end of the response and ok if p is valid, if not the
+// response is considered malformed.
+type TerminatorMatcher func(p PacketView) (done bool, ok bool)
+
+// DefaultTerminatorMatcher is the default TerminatorMatcher.
+// It accepts the empty echo of the responseValue packet, completing the
+// response on the following packet with body 0x00000100. For servers which
+// don't echo it, a reply with an "Unknown request" body also completes the
+// response.
+func DefaultTerminatorMatcher(p PacketView) (done bool, ok bool) {
+	switch {
+	case len(p.Body) == 0:
+		// Echoed response packet.
+		return false, true
+	case bytes.Equal(p.Body, responseBody):
+		// Response packet response.
+		return true, true
+	case bytes.HasPrefix(p.Body, unknownRequest):
+		// No echo, but confirms the end of the response.
+		return true, true
+	}
+
+	return false, false
+}
+
+// setMultiPacket installs the read and write functions for multi-packet mode if
+// enabled, otherwise those for single-packet mode.
+func (c *Client) setMultiPacket(enabled bool) {
+	c.multi = enabled
+	if enabled {
+		c.read = c.readMulti
+		if c.strict {
+			c.read = c.readStrict
+		}
+		c.write = c.writeMulti
+		return
+	}
+
+	c.read = c.readSingle
+	c.write = c.writePkt
+}
+
+// MultiPacket returns true if the client is in multi-packet mode, false if
+// multi-packet support has been disabled.
+func (c *Client) MultiPacket() bool {
+	return c.multi
+}
+
+// auth authenticates with the server if a password is set, otherwise its a no-op.
+// If multiple passwords are set they are tried in order until one succeeds.
+func (c *Client) auth() error {
+	if len(c.pwds) == 0 {
+		return c.authPwd(c.pwd)
+	}
+
+	var err error
+	for _, pwd := range c.pwds {
+		if err = c.authPwd(pwd); !errors.Is(err, ErrAuthFailure) {
+			if err == nil {
+				c.pwd = pwd
+			}
+			return err
+		}
+	}
+
+	return err
+}
+
+// authPwd authenticates with the server using pwd if set, otherwise its a no-op.
+func (c *Client) authPwd(pwd string) error {
+	if pwd == "" {
+		return nil
+	}
+
+	// The server echoes the ID of the auth request, so capture it before
+	// writePkt increments it.
+	id := c.reqID
+	if err := c.writePkt(auth, pwd); err != nil {
+		return err
+	}
+
+	p, err := c.readPkt()
+	if err != nil {
+		return err
+	}
+
+	if err = c.banner(p.body); err != nil {
+		return err
+	} else if p.ID != id {
+		if p.Type == authResponse {
+			// Allow the next password to be tried.
+			c.drainAuth(id) // nolint: errcheck
+		}
+		return &AuthError{ID: p.ID, Type: p.Type}
+	}
+
+	// The official spec says we should get a responseValue followed by authResponse
+	// however Minecraft doesn't send the responseValue packet and some servers
+	// send it after the authResponse, so we deal with those cases too.
+	switch {
+	case p.Type == responseValue:
+		if p, err = c.readPkt(); err != nil {
+			return err
+		}
+
+		if p.ID != id || p.Type != authResponse {
+			return &AuthError{ID: p.ID, Type: p.Type}
+		}
+		return nil
+	case p.Type != authResponse:
+		return &AuthError{ID: p.ID, Type: p.Type}
+	}
+
+	return c.drainAuth(id)
+}
+
+// drainAuth consumes the responseValue packet with id which some servers send
+// after the authResponse, if it arrives within authDrainTimeout, so it isn't
+// mistaken for part of the response to the next command. Minecraft never
+// sends it, so it's not waited for with the minecraft flavour.
+func (c *Client) drainAuth(id int32) error {
+	if !c.tcp() || c.flavour == "minecraft" {
+		return nil
+	}
+
+	if ok, err := c.waitPkt(authDrainTimeout); err != nil || !ok {
+		return err
+	}
+
+	pid, pktType, err := c.peekHeader()
+	if err != nil || pid != id || pktType != responseValue {
+		return err
+	}
+
+	_, err = c.readPkt()
+	return err
+}
+
+// RegisterAlias registers name as a client-side alias for cmd, so that
+// Exec(name) executes cmd instead. Aliases aren't expanded by ExecCmd.
+func (c *Client) RegisterAlias(name string, cmd *Cmd) {
+	c.amtx.Lock()
+	defer c.amtx.Unlock()
+
+	if c.aliases == nil {
+		c.aliases = make(map[string]*Cmd)
+	}
+	c.aliases[name] = cmd
+}
+
+// Exec creates a new Cmd from cmd and calls ExecCmd with it.
+// If cmd is a registered alias the Cmd it refers to is executed instead.
+// If cmd contains non-ASCII characters it returns ErrNonASCII, unless
+// AllowNonASCII or a command encoder, see WithCommandEncoder, is set.
+func (c *Client) Exec(cmd string) (string, error) {
+	c.amtx.RLock()
+	alias, ok := c.aliases[cmd]
+	c.amtx.RUnlock()
+	if ok {
+		return c.ExecCmd(alias)
+	}
+
+	return c.ExecCmd(NewCmd(cmd))
+}
+
+// ExecCmd executes cmd on the server and returns the response.
+// If cmd contains non-ASCII characters it returns ErrNonASCII, unless
+// AllowNonASCII or a command encoder, see WithCommandEncoder, is set.
+// If unknown command detection is enabled and the server reports cmd as
+// unknown it returns ErrUnknownCommand.
+// Commands are run through any middlewares added by Use.
+// Errors are wrapped with the command, with the arguments of commands which
+// set passwords redacted.
+func (c *Client) ExecCmd(cmd *Cmd) (string, error) {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	start := c.now()
+	resp, err := c.execFn(ctx, cmd)
+	c.logSlow(cmd, start)
+	if err != nil {
+		return resp, c.execErr(cmd.redacted(), err)
+	}
+
+	return resp, nil
+}
+
+// ExecLines calls ExecCmd with cmd and returns the response split into lines,
+// for line oriented output such as a list of players. Lines may be terminated
+// by \n or \r\n, which isn't included, and trailing empty lines are dropped.
+func (c *Client) ExecLines(cmd *Cmd) ([]string, error) {
+	resp, err := c.ExecCmd(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return splitLines(resp), nil
+}
+
+// splitLines splits s into lines, dropping trailing empty lines.
+func splitLines(s string) []string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// execCmd is the ExecFunc at the end of the middleware chain, which executes
+// cmd on the server.
+func (c *Client) execCmd(ctx context.Context, cmd *Cmd) (resp string, err error) {
+	if err = ctx.Err(); err != nil {
+		return "", err
+	}
+
+	body, err := c.encode(cmd.String())
+	if err != nil {
+		return "", err
+	}
+
+	if c.dryRun {
+		return c.dryRunExec(body)
+	}
+
+	if resp, err = c.exec(body, c.timeoutFor(cmd)); err != nil {
+		// Partial responses are returned if ReturnPartialOnEOF is enabled.
+		return resp, err
+	}
+
+	if c.unknownCmd && unknownCommand(resp) {
+		return "", ErrUnknownCommand(cmd.cmd)
+	}
+
+	return resp, nil
+}
+
+// timeoutFor returns the timeout for cmd, if it overrides the client timeout.
+func (c *Client) timeoutFor(cmd *Cmd) time.Duration {
+	if cmd.timeout > 0 || c.cmdTimeout == nil {
+		return cmd.timeout
+	}
+	return c.cmdTimeout(cmd.name())
+}
+
+// ExecCallback executes cmd on the server calling onChunk with the body of
+// each response packet as it arrives, rather than combining them into a single
+// string, allowing large responses to be processed incrementally. onChunk must
+// not retain body after it returns.
+//
+// If onChunk returns an error the read is stopped and the error is returned.
+// Any remaining response packets are left unread, so the connection should be
+// Reset before it's used again.
+//
+// Aliases and middlewares aren't applied to commands executed by ExecCallback.
+func (c *Client) ExecCallback(cmd *Cmd, onChunk func(body []byte) error) error {
+	if c.dryRun {
+		return ErrDryRun
+	}
+
+	defer c.logSlow(cmd, c.now())
+
+	body, err := c.encode(cmd.String())
+	if err != nil {
+		return c.execErr(cmd.redacted(), err)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.execChunksLocked(body, onChunk); err != nil {
+		return c.execErr(cmd.redacted(), c.ctxErr(err))
+	}
+
+	return nil
+}
+
+// dryRunExec returns the dry-run response for body.
+func (c *Client) dryRunExec(body string) (string, error) {
+	if c.maxCmd > 0 && len(body) > c.maxCmd {
+		return "", ErrCommandTooLarge
+	}
+
+	return DryRunPrefix + body, nil
+}
+
+// ExecAndWait executes cmd on the server then reads packets until the body of
+// one matches match, returning it, for commands such as changelevel whose real
+// result is reported by a later unsolicited packet. The immediate response is
+// checked first. timeout bounds the entire exchange, if it elapses before a
+// match is found a timeout error is returned.
+//
+// Aliases and middlewares aren't applied to commands executed by ExecAndWait.
+func (c *Client) ExecAndWait(cmd *Cmd, match func(body string) bool, timeout time.Duration) (string, error) {
+	if c.dryRun {
+		return "", ErrDryRun
+	}
+
+	body, err := c.encode(cmd.String())
+	if err != nil {
+		return "", c.execErr(cmd.redacted(), err)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	resp, err := c.waitLocked(body, match, timeout)
+	if err != nil {
+		// The response is returned with ErrPossiblyTruncated.
+		return resp, c.execErr(cmd.redacted(), c.ctxErr(err))
+	}
+
+	return resp, nil
+}
+
+// waitLocked executes body on the server then reads packets until one matches
+// or timeout elapses. If the matching packet is the response to body and it
+// may have been truncated it's returned along with ErrPossiblyTruncated. The
+// caller must hold c.mtx.
+func (c *Client) waitLocked(body string, match func(body string) bool, timeout time.Duration) (string, error) {
+	c.deadline = c.now().Add(timeout)
+	defer func() {
+		c.deadline = time.Time{}
+	}()
+
+	resp, err := c.execLocked(body)
+	if err != nil && !errors.Is(err, ErrPossiblyTruncated) {
+		return "", err
+	} else if match(resp) {
+		return resp, err
+	}
+
+	for !match(resp) {
+		p, err := c.readPkt()
+		if err != nil {
+			return "", err
+		}
+		resp = p.Body()
+	}
+
+	return resp, nil
+}
+
+// ExecRawString executes s on the server as is and returns the response.
+//
+// Unlike Exec and ExecCmd no validation of s is performed, so its the callers
+// responsibility to ensure s is safe to send. This is intended for trusted
+// callers sending pre-validated commands, Exec should be preferred otherwise.
+func (c *Client) ExecRawString(s string) (string, error) {
+	if c.dryRun {
+		return "", ErrDryRun
+	}
+
+	return c.exec(s, 0)
+}
+
+// RTT returns the round trip time of a minimal probe, an empty responseValue
+// packet which the server echoes as it does in multi-packet mode, isolating
+// network latency from the time taken by the server to process commands.
+// Servers which don't reply to the probe cause RTT to time out.
+func (c *Client) RTT() (time.Duration, error) {
+	if c.dryRun {
+		return 0, ErrDryRun
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if err := c.usable(); err != nil {
+		return 0, err
+	}
+
+	// readMulti treats packets with the ID following expectedID as replies to
+	// the probe, so expect the ID preceding the probes.
+	id := c.reqID
+	start := c.now()
+	if err := c.writePkt(responseValue, ""); err != nil {
+		return 0, c.ctxErr(err)
+	}
+
+	if err := c.readMulti(id-1, discardChunk); err != nil {
+		c.poison(err)
+		return 0, c.ctxErr(err)
+	}
+
+	return c.now().Sub(start), nil
+}
+
+// WritePacket writes a single packet of type pktType with body to the server
+// and returns its ID. Together with ReadPacket it allows custom request and
+// response patterns to be implemented on top of the authenticated connection,
+// without the multi-packet handling of ExecCmd.
+func (c *Client) WritePacket(pktType int32, body string) (int32, error) {
+	if c.dryRun {
+		return 0, ErrDryRun
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	id := c.reqID
+	if err := c.writePkt(pktType, body); err != nil {
+		return 0, c.ctxErr(err)
+	}
+
+	return id, nil
+}
+
+// ReadPacket reads a single packet from the server, see WritePacket.
+func (c *Client) ReadPacket() (*Response, error) {
+	if c.dryRun {
+		return nil, ErrDryRun
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	p, err := c.readPkt()
+	if err != nil {
+		return nil, c.ctxErr(err)
+	}
+
+	return &Response{ID: p.ID, Type: p.Type, Body: p.Body()}, nil
+}
+
+// PeekType returns the type of the next packet from the server without
+// consuming it, so a following ReadPacket or command still reads the whole
+// packet. It blocks until the header of the packet has arrived, which is
+// bounded by the client timeout as for a read, and a timeout leaves the
+// connection usable as nothing is consumed.
+//
+// If the client uses a custom Transport it returns ErrUnsupportedTransport.
+func (c *Client) PeekType() (int32, error) {
+	if c.dryRun {
+		return 0, ErrDryRun
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.tcp() {
+		return 0, ErrUnsupportedTransport
+	}
+
+	_, pktType, err := c.peekHeader()
+	if err != nil {
+		return 0, c.ctxErr(err)
+	}
+
+	return pktType, nil
+}
+
+// validate returns a NonASCIIError if body contains non-ASCII characters.
+func validate(body string) error {
+	for i, r := range body {
+		if r >= 0x80 {
+			return &NonASCIIError{Rune: r, Offset: i}
+		}
+	}
+	return nil
+}
+
+// exec executes body on the server and returns the response. If timeout is
+// non-zero it overrides the client timeout for the command.
+func (c *Client) exec(body string, timeout time.Duration) (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if timeout > 0 {
+		defer func(d time.Duration) {
+			c.timeout = d
+		}(c.timeout)
+		c.timeout = timeout
+	}
+
+	resp, err := c.execLocked(body)
+	if err != nil {
+		return resp, c.ctxErr(err)
+	}
+
+	return resp, nil
+}
+
+// execLocked executes body on the server and returns the response.
+// The caller must hold c.mtx.
+func (c *Client) execLocked(body string) (string, error) {
+	return c.collect(func(onChunk func(body []byte) error) error {
+		return c.execChunksLocked(body, onChunk)
+	})
+}
+
+// collect calls exec with a func which accumulates the bodies of the response
+// packets, and returns the response decoded using the response decoder. If
+// exec fails after part of the response has been received, due to a timeout
+// or an EOF if ReturnPartialOnEOF is enabled, a PartialError is returned.
+func (c *Client) collect(exec func(onChunk func(body []byte) error) error) (string, error) {
+	var buf bytes.Buffer
+	var chunks int
+	err := exec(func(b []byte) error {
+		chunks++
+		_, err := buf.Write(b)
+		return err
+	})
+	if err != nil {
+		switch {
+		case buf.Len() > 0 && timeout(err):
+			return "", &PartialError{Body: buf.String(), Err: err}
+		case buf.Len() > 0 && c.partialEOF && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)):
+			return buf.String(), &PartialError{Body: buf.String(), Err: err}
+		}
+		return "", err
+	}
+
+	resp, err := c.decode(buf.Bytes())
+	if err == nil && c.truncated(chunks, buf.Len()) {
+		return resp, ErrPossiblyTruncated
+	}
+
+	return resp, err
+}
+
+// truncated returns true if a response of n bytes in chunks packets may have
+// been truncated by the server, see WithTruncationThreshold.
+func (c *Client) truncated(chunks, n int) bool {
+	return !c.multi && chunks == 1 && c.truncAt > 0 && n == c.truncAt
+}
+
+// decode converts the combined body of a response to a string using the
+// response decoder, if set.
+func (c *Client) decode(body []byte) (string, error) {
+	if c.decoder == nil {
+		return string(body), nil
+	}
+
+	resp, err := c.decoder(body)
+	if err != nil {
+		return "", fmt.Errorf("source: decode response: %w", err)
+	}
+
+	return resp, nil
+}
+
+// execChunksLocked executes body on the server calling onChunk with the body
+// of each response packet. The caller must hold c.mtx.
+func (c *Client) execChunksLocked(body string, onChunk func(body []byte) error) error {
+	return c.sendLocked(body, c.write, c.read, onChunk)
+}
+
+// sendLocked executes body on the server, writing it with write and reading
+// the response with read, see commandLocked. The caller must hold c.mtx.
+func (c *Client) sendLocked(body string, write func(pktType int32, body string) error, read func(expectedID int32, onChunk func(body []byte) error) error, onChunk func(body []byte) error) error {
+	id := c.reqID
+	return c.commandLocked(id, body, onChunk, func(onChunk func(body []byte) error) error {
+		if err := c.usable(); err != nil {
+			return err
+		} else if c.maxCmd > 0 && len(body) > c.maxCmd {
+			return ErrCommandTooLarge
+		}
+		defer c.fixDeadline()()
+
+		if err := write(execCommand, body); err != nil {
+			return err
+		}
+
+		return read(id, onChunk)
+	})
+}
+
+// commandLocked calls exec to execute body, sent with request id, passing it
+// onChunk wrapped to limit the response to the maximum response size and
+// unwrap the body of each packet using the body framer. The command is logged
+// and counted, and the connection is poisoned if the response is malformed,
+// so all methods which execute commands behave consistently. The caller must
+// hold c.mtx.
+func (c *Client) commandLocked(id int32, body string, onChunk func(body []byte) error, exec func(onChunk func(body []byte) error) error) (err error) {
+	onChunk, logged := c.logCommand(id, body, onChunk)
+	defer func() {
+		c.countCommand(err)
+		c.poison(err)
+		logged(err)
+	}()
+
+	return exec(c.frameChunks(c.limitChunks(onChunk)))
+}
+
+// logSlow calls the slow command log with cmd if it has taken longer than the
+// threshold since start, see WithSlowCommandLog.
+func (c *Client) logSlow(cmd *Cmd, start time.Time) {
+	if d := c.now().Sub(start); c.slowLog != nil && d > c.slowAfter {
+		c.slowLog(cmd.redacted(), d)
+	}
+}
+
+// frameChunks returns onChunk wrapped to unwrap the body of each packet using
+// the body framer, if set.
+func (c *Client) frameChunks(onChunk func(body []byte) error) func(body []byte) error {
+	if c.framer == nil {
+		return onChunk
+	}
+
+	return func(body []byte) error {
+		b, err := c.framer(body)
+		if err != nil {
+			return fmt.Errorf("source: body framing: %w", err)
+		}
+		return onChunk(b)
+	}
+}
+
+// limitChunks returns onChunk wrapped to return ErrResponseTooLarge if the
+// total size of the chunks exceeds the maximum response size, if set.
+func (c *Client) limitChunks(onChunk func(body []byte) error) func(body []byte) error {
+	if c.maxResp <= 0 {
+		return onChunk
+	}
+
+	var total int
+	return func(body []byte) error {
+		if total += len(body); total > c.maxResp {
+			return ErrResponseTooLarge
+		}
+		return onChunk(body)
+	}
+}
+
+// fixDeadline sets the deadline of a command if required by the deadline
+// policy and one isn't already set, returning a func which clears it.
+func (c *Client) fixDeadline() func() {
+	if c.policy != FixedDeadline || !c.deadline.IsZero() {
+		return func() {}
+	}
+
+	c.deadline = c.now().Add(c.timeout)
+	return func() {
+		c.deadline = time.Time{}
+	}
+}
+
+// ExecExpectingN executes cmd on the server and returns the combined bodies of
+// exactly n response packets, for servers which don't support multi-packet
+// responses but send a known number of packets. If fewer than n packets arrive
+// before the timeout a PartialError is returned.
+//
+// Aliases and middlewares aren't applied to commands executed by
+// ExecExpectingN.
+func (c *Client) ExecExpectingN(cmd *Cmd, n int) (string, error) {
+	if c.dryRun {
+		return "", ErrDryRun
+	}
+
+	defer c.logSlow(cmd, c.now())
+
+	body, err := c.encode(cmd.String())
+	if err != nil {
+		return "", c.execErr(cmd.redacted(), err)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	resp, err := c.execNLocked(body, n)
+	if err != nil {
+		// The response is returned with ErrPossiblyTruncated.
+		return resp, c.execErr(cmd.redacted(), c.ctxErr(err))
+	}
+
+	return resp, nil
+}
+
+// execNLocked executes body on the server and returns the combined bodies of
+// n response packets. The caller must hold c.mtx.
+func (c *Client) execNLocked(body string, n int) (string, error) {
+	read := func(expectedID int32, onChunk func(body []byte) error) error {
+		return c.readN(expectedID, n, onChunk)
+	}
+
+	return c.collect(func(onChunk func(body []byte) error) error {
+		return c.sendLocked(body, c.writePkt, read, onChunk)
+	})
+}
+
+// readN reads n packets with expectedID calling onChunk with their bodies.
+func (c *Client) readN(expectedID int32, n int, onChunk func(body []byte) error) error {
+	var unexpected int
+	for i := 0; i < n; {
+		p, err := c.readPkt()
+		if err != nil {
+			if i > 0 {
+				return fmt.Errorf("source: received %v of %v packets: %w", i, n, err)
+			}
+			return err
+		}
+
+		if p.ID != expectedID {
+			if err = c.unexpectedPkt(p, &unexpected); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = onChunk(p.body); err != nil {
+			return err
+		}
+		i++
+	}
+
+	return nil
+}
+
+// unknownCommand returns true if resp is an unknown command response.
+func unknownCommand(resp string) bool {
+	return hasUnknownPrefix(resp, unknownCommandPrefixes)
+}
+
+// hasUnknownPrefix returns true if resp, ignoring case and surrounding white
+// space, starts with one of the lower case prefixes.
+func hasUnknownPrefix(resp string, prefixes []string) bool {
+	resp = strings.ToLower(strings.TrimSpace(resp))
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(resp, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close closes the connection to the server.
+func (c *Client) Close() error {
+	c.stopReauth()
+	wait := c.stopQueue()
+	err := c.closeConn()
+	wait()
+
+	return err
+}
+
+// discardChunk is an onChunk function which discards the body.
+func discardChunk([]byte) error {
+	return nil
+}
+
+// readSingle reads a single packet, validates its ID matches expectedID and
+// calls onChunk with its body.
+func (c *Client) readSingle(expectedID int32, onChunk func(body []byte) error) error {
+	var unexpected int
+	for {
+		p, err := c.readPkt()
+		if err != nil {
+			return err
+		}
+
+		if p.ID == expectedID {
+			if err = onChunk(p.body); err != nil {
+				return err
+			}
+			return c.readFragments(expectedID, onChunk)
+		}
+
+		if err = c.unexpectedPkt(p, &unexpected); err != nil {
+			return err
+		}
+	}
+}
+
+// readFragments reads further packets with expectedID which arrive within the
+// grace period, calling onChunk with their bodies.
+func (c *Client) readFragments(expectedID int32, onChunk func(body []byte) error) error {
+	for c.grace > 0 {
+		if ok, err := c.waitPkt(c.grace); err != nil {
+			return err
+		} else if !ok {
+			break
+		}
+
+		id, _, err := c.peekHeader()
+		if err != nil {
+			return err
+		} else if id != expectedID {
+			// Leave it for the next read.
+			break
+		}
+
+		p, err := c.readPkt()
+		if err != nil {
+			return err
+		}
+
+		if err = onChunk(p.body); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readMulti reads responses packets from the server calling onChunk with the
+// body of each packet of the multi-packet response until its terminated.
+func (c *Client) readMulti(expectedID int32, onChunk func(body []byte) error) error {
+	var unexpected int
+	for {
+		p, err := c.readPkt()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case p.ID != expectedID && p.ID != expectedID+1:
+			if err = c.unexpectedPkt(p, &unexpected); err != nil {
+				return err
+			}
+		case p.Type != responseValue:
+			return ErrMalformedResponse("unexpected type")
+		case p.ID == expectedID:
+			// Command response packets, one or more expected.
+			if err = onChunk(p.body); err != nil {
+				return err
+			}
+		default:
+			// Response response packets, which terminate the response.
+			done, ok := c.terminator(p.view())
+			if !ok {
+				return ErrMalformedResponse(fmt.Sprintf("unexpected body %q", p.Body()))
+			}
+			if done {
+				return nil
+			}
+		}
+	}
+}
+
+// timeout returns true if err is a timeout error.
+func timeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// unexpectedPkt handles a packet p with an unexpected ID, passing it to the
+// unsolicited packet handler if set, otherwise incrementing cnt and returning
+// an error if it exceeds the configured tolerance.
+func (c *Client) unexpectedPkt(p *pkt, cnt *int) error {
+	if c.unsolicited != nil {
+		c.unsolicited(p.Body())
+		return nil
+	}
+
+	*cnt++
+	if *cnt > c.idTolerance {
+		return ErrMalformedResponse(fmt.Sprintf("unexpected packet id %v", p.ID))
+	}
+
+	c.logf("source: %v: ignoring packet with unexpected id %v", c.server(), p.ID)
+	c.logUnexpected(p)
+	return nil
+}
+
+// readPkt reads a single packet from the server and returns it.
+// All packet reads must go through readPkt, as its responsible for setting the
+// deadline which bounds the time taken to read the packet, and poisoning the
+// connection if the packet is malformed.
+func (c *Client) readPkt() (*pkt, error) {
+	if err := c.setDeadline(); err != nil {
+		return nil, err
+	}
+
+	p, err := c.transport.ReadPacket()
+	for err == nil && c.keepalives && keepalive(p) {
+		p, err = c.transport.ReadPacket()
+	}
+	if err != nil {
+		c.poison(err)
+		return nil, err
+	}
+
+	return &pkt{Size: int32(len(p.Body) + 10), ID: p.ID, Type: p.Type, body: p.Body}, nil
+}
+
+// waitPkt waits up to d for the next packet to start arriving without
+// consuming any of it, returning false if it didn't.
+func (c *Client) waitPkt(d time.Duration) (bool, error) {
+	if err := c.conn.SetReadDeadline(c.now().Add(d)); err != nil {
+		return false, err
+	}
+
+	if _, err := c.reader.Peek(1); err != nil {
+		if timeout(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// peekHeader returns the ID and type of the next packet without consuming it.
+func (c *Client) peekHeader() (id, pktType int32, err error) {
+	if err = c.setDeadline(); err != nil {
+		return 0, 0, err
+	}
+
+	b, err := c.reader.Peek(pktHeaderSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int32(binary.LittleEndian.Uint32(b[4:])), int32(binary.LittleEndian.Uint32(b[8:])), nil
+}
+
+// writeMulti writes a packet with type t and body followed by a empty body
+// responseValue type packet, so that we can easily decode multi-packet responses.
+// https://developer.valvesoftware.com/wiki/Source_RCON_Protocol#Multiple-packet_Responses
+func (c *Client) writeMulti(pktType int32, body string) error {
+	id := c.reqID
+	if err := c.writePkt(pktType, body); err != nil {
+		return err
+	}
+
+	// Now send an empty server response packet which will be echoed back, allowing
+	// us to easily determine if we are processing a multi packet response.
+	if c.idGen == nil {
+		return c.writePkt(responseValue, "")
+	}
+
+	// readMulti expects the echo to have the ID following that of the command.
+	return c.writePktID(id+1, responseValue, "")
+}
+
+// writePkt writes a single packet to the server using the next request ID.
+func (c *Client) writePkt(pktType int32, body string) error {
+	id := c.reqID
+	if c.idGen != nil {
+		c.reqID = c.idGen()
+	} else {
+		c.reqID++
+	}
+
+	return c.writePktID(id, pktType, body)
+}
+
+// resetID resets the next request ID to the initial request ID, or the next
+// one returned by the request ID generator if set.
+func (c *Client) resetID() {
+	if c.idGen != nil {
+		c.reqID = c.idGen()
+		return
+	}
+	c.reqID = c.initialID
+}
+
+// writePktID writes a single packet with the given ID to the server.
+func (c *Client) writePktID(id, pktType int32, body string) error {
+	p := &Packet{ID: id, Type: pktType, Body: []byte(body)}
+	if err := c.setDeadline(); err != nil {
+		return err
+	}
+
+	return c.transport.WritePacket(p)
+}
+
+// setDeadline updates the deadline on the connection based on the clients
+// configured timeout, or the fixed deadline of the current command if set.
+// Its a no-op if the transport doesn't support deadlines.
+func (c *Client) setDeadline() error {
+	d, ok := c.transport.(deadliner)
+	if !ok {
+		return nil
+	}
+	if !c.deadline.IsZero() {
+		return d.SetDeadline(c.deadline)
+	}
+	return d.SetDeadline(c.now().Add(c.timeout))
 }
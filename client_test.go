@@ -1,10 +1,20 @@
 package source
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -26,6 +36,7 @@ func TestClient(t *testing.T) {
 	defer func() {
 		assert.NoError(t, c.Close())
 	}()
+	assert.True(t, c.MultiPacket())
 
 	_, err = c.Exec("status")
 	assert.NoError(t, err)
@@ -36,48 +47,1869 @@ func TestClient(t *testing.T) {
 	resp, err2 := c.Exec("invalid")
 	assert.NoError(t, err2)
 	assert.Equal(t, "unknown command 2:invalid", resp)
+
+	_, err = c.Exec("caf\u00e9")
+	assert.ErrorIs(t, err, ErrNonASCII)
+	assert.EqualError(t, err, "source: exec \"caf\u00e9\": source: non-ascii body: '\u00e9' at offset 3")
+	var asciiErr *NonASCIIError
+	if assert.ErrorAs(t, err, &asciiErr) {
+		assert.Equal(t, &NonASCIIError{Rune: '\u00e9', Offset: 3}, asciiErr)
+	}
+
+	resp, err = c.ExecRawString("caf\u00e9")
+	assert.NoError(t, err)
+	assert.Equal(t, "unknown command 2:caf\u00e9", resp)
+}
+
+func TestClientUnknownRequest(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:", responseValue)] = []*pkt{newPkt(responseValue, 0, "Unknown request 0")}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+		assert.NoError(t, err)
+		assert.Equal(t, "test me", resp)
+	}
+}
+
+func TestClientTerminatorMatcher(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:", responseValue)] = []*pkt{
+		newPkt(responseValue, 0, "ACK"),
+		newPkt(responseValue, 0, "END"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	m := func(p PacketView) (bool, bool) {
+		switch string(p.Body) {
+		case "ACK":
+			return false, true
+		case "END":
+			return true, true
+		}
+		return false, false
+	}
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithTerminatorMatcher(m))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
+
+func TestDefaultTerminatorMatcher(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		done bool
+		ok   bool
+	}{
+		{"echo", nil, false, true},
+		{"response", responseBody, true, true},
+		{"unknown-request", []byte("Unknown request 0"), true, true},
+		{"invalid", []byte("invalid"), false, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			done, ok := DefaultTerminatorMatcher(PacketView{Type: responseValue, Body: tc.body})
+			assert.Equal(t, tc.done, done)
+			assert.Equal(t, tc.ok, ok)
+		})
+	}
+}
+
+func TestClientUnexpectedIDTolerance(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:late", execCommand)] = []*pkt{
+		newPkt(responseValue, -10, "stale"),
+		newPkt(responseValue, -5, "stale"),
+		newPkt(responseValue, 0, "fresh"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	tests := []struct {
+		name      string
+		tolerance int
+		err       bool
+	}{
+		{"none", 0, true},
+		{"below", 1, true},
+		{"exact", 2, false},
+		{"above", 5, false},
+	}
+
+	for _, multi := range []bool{true, false} {
+		for _, tc := range tests {
+			t.Run(fmt.Sprintf("%v-multi-%v", tc.name, multi), func(t *testing.T) {
+				var logged int
+				logf := func(format string, args ...interface{}) {
+					logged++
+				}
+				opts := []func(*Client) error{
+					Timeout(time.Second * 2),
+					WithUnexpectedIDTolerance(tc.tolerance),
+					WithLogger(logf),
+				}
+				if !multi {
+					opts = append(opts, DisableMultiPacket())
+				}
+
+				c, err := NewClient(s.Addr, opts...)
+				if !assert.NoError(t, err) {
+					return
+				}
+				defer func() {
+					assert.NoError(t, c.Close())
+				}()
+
+				resp, err := c.Exec("late")
+				if tc.err {
+					assert.Error(t, err)
+					return
+				}
+
+				assert.NoError(t, err)
+				assert.Equal(t, "fresh", resp)
+				assert.Equal(t, 2, logged)
+			})
+		}
+	}
+}
+
+func TestClientUnsolicitedHandler(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:status", execCommand)] = []*pkt{
+		newPkt(responseValue, -10, "chat: hello"),
+		newPkt(authResponse, -20, "admin: notice"),
+		newPkt(responseValue, 0, "ok"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	for _, multi := range []bool{true, false} {
+		t.Run(fmt.Sprintf("multi-%v", multi), func(t *testing.T) {
+			var pushed []string
+			opts := []func(*Client) error{
+				Timeout(time.Second * 2),
+				WithUnsolicitedHandler(func(body string) {
+					pushed = append(pushed, body)
+				}),
+			}
+			if !multi {
+				opts = append(opts, DisableMultiPacket())
+			}
+
+			c, err := NewClient(s.Addr, opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			resp, err := c.Exec("status")
+			assert.NoError(t, err)
+			assert.Equal(t, "ok", resp)
+			assert.Equal(t, []string{"chat: hello", "admin: notice"}, pushed)
+		})
+	}
+
+	_, err := NewClient(s.Addr, WithUnsolicitedHandler(nil))
+	assert.ErrorIs(t, err, ErrNilOption)
+}
+
+func TestClientDisableMultiPacket(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+	assert.False(t, c.MultiPacket())
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
+
+func TestClientMinecraftFragmentWorkaround(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:list", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "fragment 1, "),
+		newPkt(responseValue, 0, "fragment 2"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DisableMultiPacket(), MinecraftFragmentWorkaround())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.Exec("list")
+	assert.NoError(t, err)
+	assert.Equal(t, "fragment 1, fragment 2", resp)
+
+	resp, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
+
+func TestClientTruncationThreshold(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	full := strings.Repeat("x", DefaultTruncationThreshold)
+	s.responses[fmt.Sprintf("%v:full", execCommand)] = []*pkt{newPkt(responseValue, 0, full)}
+	s.responses[fmt.Sprintf("%v:short", execCommand)] = []*pkt{newPkt(responseValue, 0, full[:10])}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.Exec("full")
+	assert.ErrorIs(t, err, ErrPossiblyTruncated)
+	assert.Equal(t, full, resp)
+
+	resp, err = c.Exec("short")
+	assert.NoError(t, err)
+	assert.Equal(t, full[:10], resp)
+
+	// A custom threshold.
+	c2, err := NewClient(s.Addr, Timeout(time.Second*2), DisableMultiPacket(), WithTruncationThreshold(10))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c2.Close())
+	}()
+
+	_, err = c2.Exec("short")
+	assert.ErrorIs(t, err, ErrPossiblyTruncated)
+
+	resp, err = c2.Exec("full")
+	assert.NoError(t, err)
+	assert.Equal(t, full, resp)
+}
+
+func TestClientWithSinglePacketGrace(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:list", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "fragment 1, "),
+		newPkt(responseValue, 0, "fragment 2, "),
+		newPkt(responseValue, 0, "fragment 3"),
+	}
+	s.delay = time.Millisecond * 50
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DisableMultiPacket(), WithSinglePacketGrace(time.Millisecond*300))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.Exec("list")
+	assert.NoError(t, err)
+	assert.Equal(t, "fragment 1, fragment 2, fragment 3", resp)
+
+	resp, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
+
+func TestClientDetectUnknownCommand(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DetectUnknownCommand())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	_, err = c.Exec("invalid")
+	var unknown ErrUnknownCommand
+	if assert.ErrorAs(t, err, &unknown) {
+		assert.Equal(t, ErrUnknownCommand("invalid"), unknown)
+	}
+}
+
+func TestClientAlias(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithAlias("test", NewCmd("echo").WithArgs("test me")))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+	c.RegisterAlias("ver", NewCmd("version"))
+
+	resp, err := c.Exec("test")
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	resp, err = c.Exec("ver")
+	assert.NoError(t, err)
+	assert.Equal(t, "unknown command 2:version", resp)
+
+	resp, err = c.ExecCmd(NewCmd("test"))
+	assert.NoError(t, err)
+	assert.Equal(t, "unknown command 2:test", resp)
+}
+
+func TestClientAuth(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Password(testPassword))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, c.Close())
+
+	_, err = NewClient(s.Addr, Timeout(time.Second*2), Password("bad"))
+	assert.ErrorIs(t, err, ErrAuthFailure)
+	assert.Contains(t, err.Error(), s.Addr)
+	var authErr *AuthError
+	if assert.ErrorAs(t, err, &authErr) {
+		assert.Equal(t, &AuthError{ID: -1, Type: authResponse}, authErr)
+		assert.Contains(t, err.Error(), "authentication failure: got id=-1 type=2")
+	}
+}
+
+func TestClientAuthPasswords(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithPasswords("old", "older", testPassword))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, testPassword, c.pwd)
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	assert.NoError(t, c.Close())
+
+	_, err = NewClient(s.Addr, Timeout(time.Second*2), WithPasswords("old", "older"))
+	assert.ErrorIs(t, err, ErrAuthFailure)
+}
+
+func TestClientAuthNonZeroID(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	reqID := WithInitialRequestID(5)
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), reqID, Password(testPassword))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, c.Close())
+
+	_, err = NewClient(s.Addr, Timeout(time.Second*2), reqID, Password("bad"))
+	assert.ErrorIs(t, err, ErrAuthFailure)
+}
+
+func TestClientNilOption(t *testing.T) {
+	_, err := NewClient("", nil)
+	if !assert.Error(t, err) {
+		return
+	}
+
+	assert.Equal(t, ErrNilOption, err)
+}
+
+func TestClientOptionError(t *testing.T) {
+	errBadOption := errors.New("bad option")
+	_, err := NewClient("", func(c *Client) error { return errBadOption })
+	if !assert.Error(t, err) {
+		return
+	}
+
+	assert.Equal(t, errBadOption, err)
+}
+
+func TestClientDisconnect(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, c.Close())
+
+	_, err = c.Exec("version")
+	assert.Error(t, err)
+}
+
+func TestClientReset(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Password(testPassword))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	reader := c.reader
+	for i := 0; i < 3; i++ {
+		resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+		assert.NoError(t, err)
+		assert.Equal(t, "test me", resp)
+
+		assert.NoError(t, c.Reset())
+		assert.Equal(t, int32(1), c.reqID)
+		assert.True(t, reader == c.reader)
+	}
+}
+
+func TestClientRTT(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	rtt, err := c.RTT()
+	assert.NoError(t, err)
+	assert.True(t, rtt > 0)
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	c.poisoned = true
+	_, err = c.RTT()
+	assert.ErrorIs(t, err, ErrConnPoisoned)
+}
+
+func TestClientPacket(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	id, err := c.WritePacket(TypeExecCommand, "echo test me")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	typ, err := c.PeekType()
+	if assert.NoError(t, err) {
+		assert.Equal(t, TypeResponseValue, typ)
+	}
+
+	r, err := c.ReadPacket()
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Response{ID: id, Type: TypeResponseValue, Body: "test me"}, r)
+	}
+}
+
+func TestClientPeekTypeTimeout(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Millisecond*100))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	_, err = c.PeekType()
+	assert.True(t, timeout(err))
+
+	// Nothing was consumed, so the connection is still usable.
+	resp, err := c.Exec("echo test me")
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
+
+func TestClientWriteFail(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, c.conn.(*net.TCPConn).CloseWrite())
+
+	_, err = c.Exec("version")
+	assert.Error(t, err)
+}
+
+func TestClientDefaultPort(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	host, port, err := net.SplitHostPort(s.Addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	p, err := strconv.Atoi(port)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	c, err := NewClient(host, Timeout(time.Second*2), WithDefaultPort(p))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, s.Addr, c.addr)
+	assert.NoError(t, c.Close())
+}
+
+func TestClientSlowResponse(t *testing.T) {
+	l, err := newLocalListener()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, l.Close())
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close() // nolint: errcheck
+
+		p := &pkt{}
+		if _, err = p.ReadFrom(conn); err != nil {
+			return
+		}
+
+		// Send the header then trickle the body out one byte at a time.
+		var buf bytes.Buffer
+		if _, err = newPkt(responseValue, p.ID, "slow response").WriteTo(&buf); err != nil {
+			return
+		}
+		if _, err = conn.Write(buf.Next(12)); err != nil {
+			return
+		}
+		for _, b := range buf.Bytes() {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond * 50):
+			}
+			if _, err = conn.Write([]byte{b}); err != nil {
+				return
+			}
+		}
+	}()
+
+	c, err := NewClient(l.Addr().String(), Timeout(time.Millisecond*200), DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	start := time.Now()
+	_, err = c.Exec("status")
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestClientDeadlinePolicy(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.delay = time.Millisecond * 100
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	tests := []struct {
+		name   string
+		policy DeadlinePolicy
+		err    bool
+	}{
+		{"sliding", SlidingDeadline, false},
+		{"fixed", FixedDeadline, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewClient(s.Addr, Timeout(time.Millisecond*250), WithDeadlinePolicy(tc.policy))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			// Three packets each delayed 100ms.
+			resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "test me", resp)
+		})
+	}
+}
+
+func TestClientPartialResponse(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:partial", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "part 1, "),
+		newPkt(responseValue, 0, "part 2"),
+	}
+	s.responses[fmt.Sprintf("%v:nothing", execCommand)] = []*pkt{}
+	// Never terminate the response.
+	s.responses[fmt.Sprintf("%v:", responseValue)] = []*pkt{}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Millisecond*200))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	_, err = c.Exec("partial")
+	var perr *PartialError
+	if assert.ErrorAs(t, err, &perr) {
+		assert.Equal(t, "part 1, part 2", perr.Body)
+		var netErr net.Error
+		assert.ErrorAs(t, err, &netErr)
+	}
+
+	// No response at all.
+	_, err = c.Exec("nothing")
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &perr))
+}
+
+func TestClientMaxCommandSize(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithMaxCommandSize(12))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("test me too"))
+	assert.ErrorIs(t, err, ErrCommandTooLarge)
+
+	_, err = c.ExecRawString("echo test me too")
+	assert.Equal(t, ErrCommandTooLarge, err)
+}
+
+func TestClientConnectRetry(t *testing.T) {
+	l, err := newLocalListener()
+	if !assert.NoError(t, err) {
+		return
+	}
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+
+	start := make(chan *server, 1)
+	go func() {
+		time.Sleep(time.Millisecond * 300)
+		l, err := net.Listen("tcp", addr)
+		if !assert.NoError(t, err) {
+			close(start)
+			return
+		}
+		s := newServerListener(t, l)
+		s.Start()
+		start <- s
+	}()
+
+	c, err := NewClient(addr, Timeout(time.Second), WithConnectRetry(20, time.Millisecond*50))
+	if s := <-start; s != nil {
+		defer func() {
+			assert.NoError(t, s.Close())
+		}()
+	}
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, c.Close())
+
+	_, err = NewClient(addr, Timeout(time.Second), Password("bad"), WithConnectRetry(20, time.Second))
+	assert.ErrorIs(t, err, ErrAuthFailure)
+}
+
+func TestClientContext(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:slow", execCommand)] = []*pkt{}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := NewClient(s.Addr, Timeout(time.Second*5), WithContext(ctx), DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		cancel()
+		return
+	}
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	time.AfterFunc(time.Millisecond*100, cancel)
+	start := time.Now()
+	_, err = c.Exec("slow")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, time.Since(start) < time.Second*5)
+
+	_, err = c.Exec("status")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Error(t, c.Close())
+
+	_, err = NewClient(s.Addr, WithContext(ctx))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestClientSocketBuffers(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithSocketBuffers(1<<16, 1<<15))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
+
+func TestClientDialFail(t *testing.T) {
+	c, err := NewClient("127.0.0.1", Timeout(time.Nanosecond))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "source: dial tcp 127.0.0.1:27015: ")
+		var netErr net.Error
+		assert.ErrorAs(t, err, &netErr)
+		return
+	}
+
+	// Should never get here
+	assert.NoError(t, c.Close())
+}
+
+func TestClientFailConn(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.failConn = true
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, c.Close())
+
+	start := time.Now()
+	_, err = NewClient(s.Addr, Timeout(time.Second), WithLivenessCheck(time.Millisecond*200), Password(testPassword))
+	assert.ErrorIs(t, err, ErrBackendDead)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestClientLivenessCheck(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, WithLivenessCheck(time.Millisecond*50), Password(testPassword))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
+
+func TestClientExecCallback(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:chunks", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "chunk 1"),
+		newPkt(responseValue, 0, "chunk 2"),
+		newPkt(responseValue, 0, "chunk 3"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	var chunks []string
+	err = c.ExecCallback(NewCmd("chunks"), func(body []byte) error {
+		chunks = append(chunks, string(body))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"chunk 1", "chunk 2", "chunk 3"}, chunks)
+
+	// Abort after the first chunk.
+	errStop := errors.New("stop")
+	chunks = nil
+	err = c.ExecCallback(NewCmd("chunks"), func(body []byte) error {
+		chunks = append(chunks, string(body))
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, []string{"chunk 1"}, chunks)
+
+	if !assert.NoError(t, c.Reset()) {
+		return
+	}
+
+	err = c.ExecCallback(NewCmd("caf\u00e9"), discardChunk)
+	assert.ErrorIs(t, err, ErrNonASCII)
+}
+
+func TestClientDryRun(t *testing.T) {
+	var cmds []string
+	observe := func(next ExecFunc) ExecFunc {
+		return func(ctx context.Context, cmd *Cmd) (string, error) {
+			cmds = append(cmds, cmd.String())
+			return next(ctx, cmd)
+		}
+	}
+
+	// Nothing is listening, so any dial would fail.
+	c, err := NewClient("127.0.0.1:1", DryRun(), Use(observe), WithMaxCommandSize(10))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err := c.ExecCmd(NewCmd("kick").WithArgs(3))
+	assert.NoError(t, err)
+	assert.Equal(t, DryRunPrefix+"kick 3", resp)
+	assert.Equal(t, []string{"kick 3"}, cmds)
+
+	_, err = c.Exec("caf\u00e9")
+	assert.ErrorIs(t, err, ErrNonASCII)
+
+	_, err = c.Exec("say too large")
+	assert.ErrorIs(t, err, ErrCommandTooLarge)
+
+	_, err = c.ExecRawString("status")
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	_, err = c.RTT()
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	_, err = c.WritePacket(execCommand, "status")
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	_, err = c.ReadPacket()
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	_, err = c.SendRaw([]byte("status"))
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	_, err = c.ReadRaw(make([]byte, 10))
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	_, _, err = c.Subscribe(NewCmd("log on"), nil)
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	assert.ErrorIs(t, c.SetNoDelay(true), ErrDryRun)
+
+	_, err = c.ExecBatch(NewCmd("status"))
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	assert.ErrorIs(t, c.ExecCallback(NewCmd("status"), func([]byte) error { return nil }), ErrDryRun)
+
+	_, err = c.ExecAndWait(NewCmd("status"), func(string) bool { return true }, time.Second)
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	_, err = c.ExecExpectingN(NewCmd("status"), 1)
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	_, err = c.ExecUntilIdle(NewCmd("status"), time.Millisecond)
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	assert.ErrorIs(t, c.ChangePassword("new"), ErrDryRun)
+	assert.ErrorIs(t, c.Ping(), ErrDryRun)
+
+	_, err = c.PeekType()
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	_, err = c.SupportsMultiPacket()
+	assert.ErrorIs(t, err, ErrDryRun)
+
+	assert.ErrorIs(t, c.Drain(time.Millisecond), ErrDryRun)
+
+	assert.NoError(t, c.Reset())
+	assert.NoError(t, c.Close())
+}
+
+// testClock is a manually advanced clock.
+type testClock struct {
+	mtx sync.Mutex
+	now time.Time
+}
+
+// newTestClock returns a testClock set to a fixed time.
+func newTestClock() *testClock {
+	return &testClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// Now returns the current time of the clock.
+func (tc *testClock) Now() time.Time {
+	tc.mtx.Lock()
+	defer tc.mtx.Unlock()
+	return tc.now
+}
+
+// Add advances the clock by d.
+func (tc *testClock) Add(d time.Duration) {
+	tc.mtx.Lock()
+	defer tc.mtx.Unlock()
+	tc.now = tc.now.Add(d)
+}
+
+// withClock is a test hook which sets the clock used by a Client.
+func withClock(now func() time.Time) func(*Client) error {
+	return func(c *Client) error {
+		c.now = now
+		return nil
+	}
+}
+
+// deadlineConn is a net.Conn which records the deadlines set on it.
+type deadlineConn struct {
+	net.Conn
+	deadline     time.Time
+	readDeadline time.Time
+}
+
+func (dc *deadlineConn) SetDeadline(t time.Time) error {
+	dc.deadline = t
+	return nil
+}
+
+func (dc *deadlineConn) SetReadDeadline(t time.Time) error {
+	dc.readDeadline = t
+	return nil
+}
+
+func TestClientClock(t *testing.T) {
+	clock := newTestClock()
+	c, err := NewClient("127.0.0.1:1", DryRun(), withClock(clock.Now), Timeout(time.Second*5))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	conn := &deadlineConn{}
+	c.conn = conn
+	start := clock.Now()
+
+	assert.NoError(t, c.setDeadline())
+	assert.Equal(t, start.Add(time.Second*5), conn.deadline)
+
+	clock.Add(time.Second)
+	assert.NoError(t, c.setDeadline())
+	assert.Equal(t, start.Add(time.Second*6), conn.deadline)
+
+	// A fixed deadline takes precedence.
+	c.deadline = start.Add(time.Second * 2)
+	assert.NoError(t, c.setDeadline())
+	assert.Equal(t, start.Add(time.Second*2), conn.deadline)
+}
+
+func TestClientExecAndWait(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:changelevel de_dust", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "changing level"),
+		newPkt(responseValue, 0, "Level loaded"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	loaded := func(body string) bool {
+		return strings.HasPrefix(body, "Level loaded")
+	}
+
+	resp, err := c.ExecAndWait(NewCmd("changelevel").WithArgs("de_dust"), loaded, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "Level loaded", resp)
+
+	// Immediate match.
+	resp, err = c.ExecAndWait(NewCmd("echo").WithArgs("test me"), func(string) bool { return true }, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	// No match.
+	_, err = c.ExecAndWait(NewCmd("echo").WithArgs("test me"), loaded, time.Millisecond*100)
+	var netErr net.Error
+	if assert.ErrorAs(t, err, &netErr) {
+		assert.True(t, netErr.Timeout())
+	}
+}
+
+func TestClientSmallReaderBuffer(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	large := strings.Repeat("x", maxPkt-10)
+	s.responses[fmt.Sprintf("%v:large", execCommand)] = []*pkt{newPkt(responseValue, 0, large)}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	// A reader buffer smaller than the packet must neither block nor truncate.
+	c.reader = bufio.NewReaderSize(c.conn, 512)
+
+	resp, err := c.Exec("large")
+	assert.NoError(t, err)
+	assert.Equal(t, large, resp)
+}
+
+func TestCmdWithTimeout(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.delay = time.Millisecond * 200
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Millisecond*100), DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me").WithTimeout(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	assert.Equal(t, time.Millisecond*100, c.timeout)
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	var netErr net.Error
+	if assert.ErrorAs(t, err, &netErr) {
+		assert.True(t, netErr.Timeout())
+	}
+}
+
+func TestClientWithTimeoutForCommand(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.delay = time.Millisecond * 200
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var names []string
+	c, err := NewClient(s.Addr, Timeout(time.Millisecond*100), DisableMultiPacket(), WithTimeoutForCommand(func(cmd string) time.Duration {
+		names = append(names, cmd)
+		if cmd == "echo" {
+			return time.Second
+		}
+		return 0
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	assert.Equal(t, time.Millisecond*100, c.timeout)
+
+	// The arguments are given in the command string.
+	resp, err = c.Exec("echo test me")
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	_, err = c.ExecCmd(NewCmd("status"))
+	var netErr net.Error
+	if assert.ErrorAs(t, err, &netErr) {
+		assert.True(t, netErr.Timeout())
+	}
+
+	// Cmd.WithTimeout takes precedence.
+	_, err = c.ExecCmd(NewCmd("status").WithTimeout(time.Millisecond * 10))
+	assert.Error(t, err)
+	assert.Equal(t, []string{"echo", "echo", "status"}, names)
+}
+
+func TestClientExecExpectingN(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:fragments", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "part 1, "),
+		newPkt(responseValue, 0, "part 2, "),
+		newPkt(responseValue, 0, "part 3"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Millisecond*200), DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecExpectingN(NewCmd("fragments"), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "part 1, part 2, part 3", resp)
+
+	// Fewer packets than expected.
+	_, err = c.ExecExpectingN(NewCmd("fragments"), 4)
+	var perr *PartialError
+	if assert.ErrorAs(t, err, &perr) {
+		assert.Equal(t, "part 1, part 2, part 3", perr.Body)
+		assert.Contains(t, err.Error(), "received 3 of 4 packets")
+	}
+}
+
+func TestClientSingleNullTerminator(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []func(*Client) error
+		expect  []byte
+	}{
+		{"double", nil, []byte{
+			0x10, 0x00, 0x00, 0x00, // Size
+			0x00, 0x00, 0x00, 0x00, // ID
+			0x02, 0x00, 0x00, 0x00, // Type
+			's', 't', 'a', 't', 'u', 's', 0x00, 0x00,
+		}},
+		{"single", []func(*Client) error{SingleNullTerminator()}, []byte{
+			0x0f, 0x00, 0x00, 0x00, // Size
+			0x00, 0x00, 0x00, 0x00, // ID
+			0x02, 0x00, 0x00, 0x00, // Type
+			's', 't', 'a', 't', 'u', 's', 0x00,
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := newLocalListener()
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer l.Close() // nolint: errcheck
+
+			received := make(chan []byte, 1)
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					close(received)
+					return
+				}
+				defer conn.Close() // nolint: errcheck
+
+				b := make([]byte, len(tc.expect))
+				if _, err = io.ReadFull(conn, b); err != nil {
+					close(received)
+					return
+				}
+				received <- b
+			}()
+
+			c, err := NewClient(l.Addr().String(), tc.options...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			_, err = c.WritePacket(TypeExecCommand, "status")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, <-received)
+		})
+	}
+}
+
+func TestClientInitialRequestID(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var sent bytes.Buffer
+	c, err := NewClient(s.Addr, WithInitialRequestID(42), Password(testPassword), WithWiretap(&sent, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	p, _, err := ParsePacket(sent.Bytes())
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(42), p.ID)
+		assert.Equal(t, TypeAuth, p.Type)
+	}
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	sent.Reset()
+	if !assert.NoError(t, c.Reset()) {
+		return
+	}
+	p, _, err = ParsePacket(sent.Bytes())
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(42), p.ID)
+	}
+}
+
+func TestClientRequestIDGenerator(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	next := int32(1000)
+	gen := func() int32 {
+		next += 100
+		return next
+	}
+
+	var sent bytes.Buffer
+	c, err := NewClient(s.Addr, WithRequestIDGenerator(gen), Password(testPassword), WithWiretap(&sent, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	sent.Reset()
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	// The terminator probe follows the ID of the command.
+	var ids []int32
+	for b := sent.Bytes(); len(b) > 0; {
+		p, n, err := ParsePacket(b)
+		if !assert.NoError(t, err) {
+			return
+		}
+		ids = append(ids, p.ID)
+		b = b[n:]
+	}
+	assert.Equal(t, []int32{1200, 1201}, ids)
+
+	_, err = NewClient(s.Addr, WithRequestIDGenerator(nil))
+	assert.ErrorIs(t, err, ErrNilOption)
+}
+
+func TestClientMaxResponseSize(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	flood := make([]*pkt, 100)
+	for i := range flood {
+		flood[i] = newPkt(responseValue, 0, strings.Repeat("x", 100))
+	}
+	s.responses[fmt.Sprintf("%v:flood", execCommand)] = flood
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, WithMaxResponseSize(1000))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	_, err = c.Exec("flood")
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+
+	// The remainder of the response is left unread.
+	if !assert.NoError(t, c.Reset()) {
+		return
+	}
+
+	err = c.ExecCallback(NewCmd("flood"), discardChunk)
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+}
+
+func TestClientReturnPartialOnEOF(t *testing.T) {
+	for _, partial := range []bool{true, false} {
+		t.Run(fmt.Sprintf("partial-%v", partial), func(t *testing.T) {
+			s := newServerStopped(t)
+			if s == nil {
+				return
+			}
+			s.responses[fmt.Sprintf("%v:hangup", execCommand)] = []*pkt{
+				newPkt(responseValue, 0, "part 1, "),
+				newPkt(responseValue, 0, "part 2"),
+				nil,
+			}
+			s.Start()
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			var opts []func(*Client) error
+			if partial {
+				opts = append(opts, ReturnPartialOnEOF())
+			}
+			c, err := NewClient(s.Addr, opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			resp, err := c.Exec("hangup")
+			assert.ErrorIs(t, err, io.EOF)
+			var perr *PartialError
+			if partial {
+				assert.Equal(t, "part 1, part 2", resp)
+				assert.ErrorAs(t, err, &perr)
+			} else {
+				assert.Empty(t, resp)
+				assert.False(t, errors.As(err, &perr))
+			}
+		})
+	}
+}
+
+func TestClientSetNoDelay(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var sent bytes.Buffer
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithWiretap(&sent, nil), RecordTo(io.Discard))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	assert.NoError(t, c.SetNoDelay(false))
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	assert.NoError(t, c.SetNoDelay(true))
+
+	c2, err := NewClient(s.Addr, WithTransport(&memTransport{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.ErrorIs(t, c2.SetNoDelay(true), ErrUnsupportedTransport)
 }
 
-func TestClientNilOption(t *testing.T) {
-	_, err := NewClient("", nil)
-	if !assert.Error(t, err) {
+func TestClientWithResponseDecoder(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	errDecode := errors.New("bad body")
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithResponseDecoder(func(body []byte) (string, error) {
+		if bytes.HasPrefix(body, []byte("unknown")) {
+			return "", errDecode
+		}
+		return strings.ToUpper(string(body)), nil
+	}))
+	if !assert.NoError(t, err) {
 		return
 	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
 
-	assert.Equal(t, ErrNilOption, err)
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "TEST ME", resp)
+
+	_, err = c.ExecCmd(NewCmd("unknown"))
+	assert.ErrorIs(t, err, errDecode)
 }
 
-func TestClientOptionError(t *testing.T) {
-	errBadOption := errors.New("bad option")
-	_, err := NewClient("", func(c *Client) error { return errBadOption })
-	if !assert.Error(t, err) {
+func TestClientLatin1Responses(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
 		return
 	}
+	s.responses[fmt.Sprintf("%v:status", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "name: Ren\xe9"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
 
-	assert.Equal(t, errBadOption, err)
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Latin1Responses())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("status"))
+	assert.NoError(t, err)
+	assert.Equal(t, "name: Ren\u00e9", resp)
+	assert.True(t, utf8.ValidString(resp))
 }
 
-func TestClientDisconnect(t *testing.T) {
-	s := newServer(t)
+// encodeCP1251 encodes the Cyrillic alphabet and ASCII of cmd to Windows-1251.
+func encodeCP1251(cmd string) ([]byte, error) {
+	b := make([]byte, 0, len(cmd))
+	for _, r := range cmd {
+		switch {
+		case r < 0x80:
+			b = append(b, byte(r))
+		case r >= 'А' && r <= 'я':
+			b = append(b, byte(r-'А'+0xc0))
+		default:
+			return nil, fmt.Errorf("%q not in cp1251", r)
+		}
+	}
+	return b, nil
+}
+
+func TestClientCommandEncoder(t *testing.T) {
+	s := newServerStopped(t)
 	if s == nil {
 		return
 	}
+	s.responses[fmt.Sprintf("%v:say \xcf\xf0\xe8\xe2\xe5\xf2", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "ok"),
+	}
+	s.Start()
 	defer func() {
 		assert.NoError(t, s.Close())
 	}()
 
-	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	var sent bytes.Buffer
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithCommandEncoder(encodeCP1251), WithWiretap(&sent, nil))
 	if !assert.NoError(t, err) {
 		return
 	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
 
-	assert.NoError(t, c.Close())
+	resp, err := c.ExecCmd(NewCmd("say").WithArgs("Привет"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
 
-	_, err = c.Exec("version")
+	p, _, err := ParsePacket(sent.Bytes())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte("say \xcf\xf0\xe8\xe2\xe5\xf2"), p.Body)
+	}
+
+	_, err = c.ExecCmd(NewCmd("say").WithArgs("你好"))
 	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNonASCII)
 }
 
-func TestClientWriteFail(t *testing.T) {
+func TestClientLatin1Commands(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:echo Ren\xe9", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "Ren\xe9"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Latin1Commands())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("Ren\u00e9"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Ren\xe9", resp)
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("\u4f60"))
+	assert.Error(t, err)
+}
+
+func TestClientConnPoisoned(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:bad", execCommand)] = []*pkt{
+		newPkt(authResponse, 0, "garbage"),
+		newPkt(responseValue, 0, "more garbage"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	_, err = c.ExecCmd(NewCmd("bad"))
+	assert.ErrorAs(t, err, new(ErrMalformedResponse))
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.ErrorIs(t, err, ErrConnPoisoned)
+	_, err = c.ExecExpectingN(NewCmd("echo").WithArgs("test me"), 1)
+	assert.ErrorIs(t, err, ErrConnPoisoned)
+
+	assert.NoError(t, c.Reset())
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
+
+func TestClientReadPacketPoisons(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:bad", execCommand)] = []*pkt{newSinglePkt(responseValue, 0, "bad trailer")}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	_, err = c.WritePacket(execCommand, "bad")
+	assert.NoError(t, err)
+	_, err = c.ReadPacket()
+	assert.ErrorAs(t, err, new(ErrMalformedResponse))
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.ErrorIs(t, err, ErrConnPoisoned)
+}
+
+// shortWriteConn is a net.Conn which writes at most n bytes of the data of
+// each write before failing.
+type shortWriteConn struct {
+	net.Conn
+	n int
+}
+
+func (c shortWriteConn) Write(b []byte) (int, error) {
+	if len(b) <= c.n {
+		return c.Conn.Write(b)
+	}
+	n, err := c.Conn.Write(b[:c.n])
+	if err == nil {
+		err = errors.New("short write")
+	}
+	return n, err
+}
+
+func TestClientPartialWritePoisons(t *testing.T) {
 	s := newServer(t)
 	if s == nil {
 		return
@@ -90,37 +1922,328 @@ func TestClientWriteFail(t *testing.T) {
 	if !assert.NoError(t, err) {
 		return
 	}
-	assert.NoError(t, c.conn.(*net.TCPConn).CloseWrite())
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
 
-	_, err = c.Exec("version")
+	c.conn = shortWriteConn{Conn: c.conn, n: 6}
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
 	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrConnPoisoned)
+
+	// The half packet on the wire must not be followed by another.
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.ErrorIs(t, err, ErrConnPoisoned)
+
+	assert.NoError(t, c.Reset())
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
 }
 
-func TestClientDialFail(t *testing.T) {
-	c, err := NewClient("127.0.0.1", Timeout(time.Nanosecond))
-	if assert.Error(t, err) {
+func TestClientSlowCommandLog(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
 		return
 	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	slow := func(next ExecFunc) ExecFunc {
+		return func(ctx context.Context, cmd *Cmd) (string, error) {
+			if cmd.String() == "save" {
+				time.Sleep(time.Millisecond * 100)
+			}
+			return next(ctx, cmd)
+		}
+	}
 
-	// Should never get here
-	assert.NoError(t, c.Close())
+	var logged []string
+	logf := func(cmd string, d time.Duration) {
+		assert.True(t, d >= time.Millisecond*100)
+		logged = append(logged, cmd)
+	}
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Use(slow), WithSlowCommandLog(time.Millisecond*50, logf))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	_, err = c.Exec("echo test me")
+	assert.NoError(t, err)
+	_, err = c.Exec("save")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"save"}, logged)
+
+	_, err = NewClient(s.Addr, WithSlowCommandLog(time.Second, nil))
+	assert.ErrorIs(t, err, ErrNilOption)
 }
 
-func TestClientFailConn(t *testing.T) {
+func TestClientExecVariantOptions(t *testing.T) {
+	variants := []struct {
+		name string
+		exec func(c *Client, cmd *Cmd) (string, error)
+	}{
+		{"ExecCmd", (*Client).ExecCmd},
+		{"ExecExpectingN", func(c *Client, cmd *Cmd) (string, error) {
+			return c.ExecExpectingN(cmd, 1)
+		}},
+		{"ExecUntilIdle", func(c *Client, cmd *Cmd) (string, error) {
+			return c.ExecUntilIdle(cmd, time.Millisecond*50)
+		}},
+		{"ExecBatch", func(c *Client, cmd *Cmd) (string, error) {
+			resps, err := c.ExecBatch(cmd)
+			if len(resps) == 0 {
+				return "", err
+			}
+			return resps[0], err
+		}},
+	}
+
+	tests := []struct {
+		name   string
+		option func(logged *[]string) func(*Client) error
+		check  func(t *testing.T, c *Client, logged []string, resp string, err error)
+	}{
+		{
+			name: "max-response-size",
+			option: func(*[]string) func(*Client) error {
+				return WithMaxResponseSize(3)
+			},
+			check: func(t *testing.T, c *Client, logged []string, resp string, err error) {
+				assert.ErrorIs(t, err, ErrResponseTooLarge)
+			},
+		},
+		{
+			name: "decoder",
+			option: func(*[]string) func(*Client) error {
+				return WithResponseDecoder(func(body []byte) (string, error) {
+					return string(bytes.ToUpper(body)), nil
+				})
+			},
+			check: func(t *testing.T, c *Client, logged []string, resp string, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, "TEST ME", resp)
+			},
+		},
+		{
+			name: "framer",
+			option: func(*[]string) func(*Client) error {
+				return WithBodyFramer(func(body []byte) ([]byte, error) {
+					return bytes.TrimPrefix(body, []byte("test ")), nil
+				})
+			},
+			check: func(t *testing.T, c *Client, logged []string, resp string, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, "me", resp)
+			},
+		},
+		{
+			name: "stats",
+			check: func(t *testing.T, c *Client, logged []string, resp string, err error) {
+				assert.NoError(t, err)
+				stats := c.Stats()
+				assert.Equal(t, uint64(1), stats.CommandsExecuted)
+				assert.Equal(t, uint64(0), stats.Errors)
+			},
+		},
+		{
+			name: "slow-log",
+			option: func(logged *[]string) func(*Client) error {
+				return WithSlowCommandLog(0, func(cmd string, d time.Duration) {
+					*logged = append(*logged, cmd)
+				})
+			},
+			check: func(t *testing.T, c *Client, logged []string, resp string, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"echo test me"}, logged)
+			},
+		},
+	}
+
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	for _, tc := range tests {
+		for _, v := range variants {
+			t.Run(tc.name+"/"+v.name, func(t *testing.T) {
+				var logged []string
+				options := []func(*Client) error{Timeout(time.Second * 2)}
+				if tc.option != nil {
+					options = append(options, tc.option(&logged))
+				}
+				c, err := NewClient(s.Addr, options...)
+				if !assert.NoError(t, err) {
+					return
+				}
+				defer func() {
+					assert.NoError(t, c.Close())
+				}()
+
+				resp, err := v.exec(c, NewCmd("echo").WithArgs("test me"))
+				tc.check(t, c, logged, resp, err)
+			})
+		}
+	}
+}
+
+func TestClientRawArg(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var sent bytes.Buffer
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), AllowNonASCII(), WithWiretap(&sent, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	payload := []byte{0x01, 0x80, 0xfe, 0xff}
+	_, err = c.ExecCmd(NewCmd("upload").WithRawArg(payload))
+	assert.NoError(t, err)
+
+	p, _, err := ParsePacket(sent.Bytes())
+	if assert.NoError(t, err) {
+		assert.Equal(t, append([]byte("upload "), payload...), p.Body)
+	}
+
+	c2, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c2.Close())
+	}()
+
+	_, err = c2.ExecCmd(NewCmd("upload").WithRawArg(payload))
+	assert.ErrorIs(t, err, ErrNonASCII)
+}
+
+func TestClientExecLines(t *testing.T) {
 	s := newServerStopped(t)
 	if s == nil {
 		return
 	}
-	s.failConn = true
+	s.responses[fmt.Sprintf("%v:users", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "player 1\r\nplayer 2\n\nplayer 3\n\n"),
+	}
+	s.responses[fmt.Sprintf("%v:none", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, ""),
+	}
 	s.Start()
 	defer func() {
 		assert.NoError(t, s.Close())
 	}()
 
-	c, err := NewClient(s.Addr, Timeout(time.Second))
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
 	if !assert.NoError(t, err) {
 		return
 	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
 
-	assert.NoError(t, c.Close())
+	lines, err := c.ExecLines(NewCmd("users"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"player 1", "player 2", "", "player 3"}, lines)
+
+	lines, err = c.ExecLines(NewCmd("none"))
+	assert.NoError(t, err)
+	assert.Empty(t, lines)
+
+	_, err = c.ExecLines(NewCmd("badé"))
+	assert.ErrorIs(t, err, ErrNonASCII)
+}
+
+func TestClientWithBodyFramer(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:framed", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "\x04\x00test"),
+		newPkt(responseValue, 0, "\x03\x00 me"),
+	}
+	s.responses[fmt.Sprintf("%v:bad", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "\x09\x00short"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	errFraming := errors.New("bad length")
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithBodyFramer(func(body []byte) ([]byte, error) {
+		if len(body) < 2 || int(binary.LittleEndian.Uint16(body)) != len(body)-2 {
+			return nil, errFraming
+		}
+		return body[2:], nil
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("framed"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	_, err = c.ExecCmd(NewCmd("bad"))
+	assert.ErrorIs(t, err, errFraming)
+}
+
+func TestClientAuthOrdering(t *testing.T) {
+	key := fmt.Sprintf("%v:%v", auth, testPassword)
+	tests := []struct {
+		name string
+		pkts []*pkt
+	}{
+		{"spec", []*pkt{newPkt(responseValue, 0, ""), newPkt(authResponse, 0, "")}},
+		{"minecraft", []*pkt{newPkt(authResponse, 0, "")}},
+		{"auth-response-first", []*pkt{newPkt(authResponse, 0, ""), newPkt(responseValue, 0, "")}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerStopped(t)
+			if s == nil {
+				return
+			}
+			s.responses[key] = tc.pkts
+			s.Start()
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			c, err := NewClient(s.Addr, Timeout(time.Second*2), Password(testPassword), DisableMultiPacket())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+			assert.NoError(t, err)
+			assert.Equal(t, "test me", resp)
+		})
+	}
 }
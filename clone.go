@@ -0,0 +1,25 @@
+package source
+
+// Clone returns a new source rcon client connected to the same server as c,
+// created with the same options, so additional connections can be made without
+// re-specifying them. The clone has its own connection and request IDs, but if
+// c has authenticated with a password, such as one chosen by WithPasswords or
+// set by ChangePassword, the clone uses it. Writers passed to options, such as
+// WithWiretap, are shared by the clients so must be safe for concurrent use.
+//
+// Clients using a custom Transport can't be cloned as the transport can't be
+// duplicated, so Clone returns ErrUnsupportedTransport.
+func (c *Client) Clone() (*Client, error) {
+	if !c.tcp() {
+		return nil, ErrUnsupportedTransport
+	}
+
+	c.mtx.Lock()
+	options := append([]func(c *Client) error(nil), c.options...)
+	if c.pwd != "" {
+		options = append(options, Password(c.pwd))
+	}
+	c.mtx.Unlock()
+
+	return NewClient(c.addr, options...)
+}
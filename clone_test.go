@@ -0,0 +1,85 @@
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientClone(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.requireAuth = true
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithPasswords("wrong", testPassword), WithInitialRequestID(10))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	c2, err := c.Clone()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c2.Close())
+	}()
+
+	assert.NotEqual(t, c.conn, c2.conn)
+	assert.Equal(t, c.timeout, c2.timeout)
+	assert.Equal(t, testPassword, c2.pwd)
+	// Only the password which was accepted was tried.
+	assert.Equal(t, int32(11), c2.reqID)
+
+	resp, err = c2.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	c3, err := NewClient(s.Addr, WithTransport(&memTransport{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c3.Clone()
+	assert.ErrorIs(t, err, ErrUnsupportedTransport)
+}
+
+func TestOpenClone(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := Open(ctx, s.Addr, Timeout(time.Second*2))
+	cancel()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	// The context passed to Open doesn't affect the clone.
+	c2, err := c.Clone()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, c2.Close())
+}
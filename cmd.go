@@ -3,12 +3,14 @@ package source
 import (
 	"fmt"
 	"strings"
+	"time"
 )
 
 // Cmd represents a source rcon command.
 type Cmd struct {
-	cmd  string
-	args []interface{}
+	cmd     string
+	args    []interface{}
+	timeout time.Duration
 }
 
 // NewCmd creates a new Cmd.
@@ -22,9 +24,68 @@ func (c *Cmd) WithArgs(args ...interface{}) *Cmd {
 	return c
 }
 
+// WithRawArg appends b to the command Args as raw bytes, which are written
+// to the body of the command as is, separated from the preceding arguments by
+// a space, rather than being formatted as a []byte argument would be.
+//
+// Bytes which aren't ASCII cause the command to be rejected with ErrNonASCII
+// unless the client is configured with AllowNonASCII. If a command encoder is
+// set, see WithCommandEncoder, it's applied to the raw bytes along with the
+// rest of the command, so it should only be combined with AllowNonASCII.
+func (c *Cmd) WithRawArg(b []byte) *Cmd {
+	c.args = append(c.args, rawArg(b))
+	return c
+}
+
+// WithTimeout sets the timeout used by ExecCmd for the command, overriding the
+// client timeout, for commands such as save which are known to be slow.
+func (c *Cmd) WithTimeout(timeout time.Duration) *Cmd {
+	c.timeout = timeout
+	return c
+}
+
+// redacted returns the command string with the arguments replaced if the
+// command sets a password, such as rcon_password.
+func (c *Cmd) redacted() string {
+	return redactBody(c.String())
+}
+
+// name returns the name of the command, the first field of its string, so
+// it's the same whether the arguments were added by WithArgs or given as part
+// of the command string.
+func (c *Cmd) name() string {
+	name, _, _ := strings.Cut(strings.TrimSpace(c.String()), " ")
+	return name
+}
+
+// WireSize returns the size in bytes of the packet which sends the command,
+// including the size, ID and type fields and the two null terminators, so it
+// can be checked against the limits of the server before it's sent. It doesn't
+// account for a command encoder, see WithCommandEncoder, or for the single
+// null terminator used by some servers.
+func (c *Cmd) WireSize() int {
+	return len(c.String()) + 14
+}
+
 func (c *Cmd) String() string {
 	args := append([]interface{}{c.cmd}, c.args...)
 	// We use fmt.Sprintln + fmt.TrimSuffix as fmt.Sprintln guarantees all args
 	// are space separated, which is what we want, where as fmt.Sprint doesn't.
 	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
 }
+
+// rawArg is a command argument which is formatted as its raw bytes.
+type rawArg []byte
+
+// Format implements fmt.Formatter.
+func (r rawArg) Format(f fmt.State, verb rune) {
+	f.Write(r) // nolint: errcheck
+}
+
+// Quote returns s wrapped in double quotes, so the server console treats it as
+// a single argument. The console has no escape sequences, so any double quotes
+// s contains are removed, and backslashes are left as is. s is always quoted
+// even if it contains no special characters, so an empty s becomes "".
+func Quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "") + `"`
+}
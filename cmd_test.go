@@ -1,6 +1,7 @@
 package source
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,6 +15,8 @@ func TestCmd(t *testing.T) {
 	}{
 		{"status", NewCmd("status"), "status"},
 		{"echo", NewCmd("echo").WithArgs("test me"), "echo test me"},
+		{"bytes", NewCmd("echo").WithArgs([]byte("ab")), "echo [97 98]"},
+		{"raw", NewCmd("echo").WithArgs(1).WithRawArg([]byte("ab\x00\xff")).WithRawArg([]byte("c")), "echo 1 ab\x00\xff c"},
 	}
 
 	for _, tc := range tests {
@@ -22,3 +25,60 @@ func TestCmd(t *testing.T) {
 		})
 	}
 }
+
+func TestCmdWireSize(t *testing.T) {
+	for _, cmd := range []*Cmd{
+		NewCmd("status"),
+		NewCmd("echo").WithArgs("test me"),
+		NewCmd("say").WithRawArg([]byte{0xff}),
+	} {
+		t.Run(cmd.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := newPkt(execCommand, 1, cmd.String()).WriteTo(&buf)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(cmd.WireSize()), n)
+			assert.Equal(t, buf.Len(), cmd.WireSize())
+		})
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name   string
+		s      string
+		expect string
+	}{
+		{"empty", "", `""`},
+		{"plain", "de_dust2", `"de_dust2"`},
+		{"spaces", "my server", `"my server"`},
+		{"quotes", `say "hi"`, `"say hi"`},
+		{"backslash", `c:\maps`, `"c:\maps"`},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, Quote(tc.s))
+		})
+	}
+}
+
+func TestCmdRedacted(t *testing.T) {
+	tests := []struct {
+		name   string
+		cmd    *Cmd
+		expect string
+	}{
+		{"status", NewCmd("status"), "status"},
+		{"kick", NewCmd("kick").WithArgs(3), "kick 3"},
+		{"rcon_password", NewCmd("rcon_password").WithArgs("secret"), "rcon_password <redacted>"},
+		{"sv_password", NewCmd("sv_password").WithArgs("secret"), "sv_password <redacted>"},
+		{"sv_password-query", NewCmd("sv_password"), "sv_password"},
+		{"rcon_password-string", NewCmd("rcon_password hunter2"), "rcon_password <redacted>"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, tc.cmd.redacted())
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package source
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// slashCommand matches a command name prefixed by a slash.
+var slashCommand = regexp.MustCompile(`/([A-Za-z][\w-]*)`)
+
+// ListCommands returns the sorted names of the commands supported by the
+// server, by executing the command listing command of the server flavour and
+// parsing its response, such as cmdlist for Source servers and help for
+// Minecraft. If no flavour is configured or detected the server is assumed
+// to be Source based. If the flavour doesn't have a command listing command
+// it returns ErrUnsupportedByFlavour, and if the server reports the command as
+// unknown it returns ErrCommandNotSupported.
+func (c *Client) ListCommands() ([]string, error) {
+	f := c.currentFlavour()
+	if f.listCmd == "" {
+		return nil, ErrUnsupportedByFlavour
+	}
+
+	resp, err := c.execFlavourCmd(f, NewCmd(f.listCmd))
+	if err != nil {
+		return nil, err
+	}
+
+	return uniqueSorted(f.parseCommands(resp)), nil
+}
+
+// parseCmdlist returns the command names from the output of the Source
+// cmdlist command, whose lines are of the form "name : cmd : flags : help".
+func parseCmdlist(resp string) []string {
+	var names []string
+	for _, line := range strings.Split(resp, "\n") {
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+
+		if name := strings.TrimSpace(fields[0]); name != "" && !strings.ContainsAny(name, " \t") {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// parseSlashCommands returns the command names prefixed by a slash in the
+// output of a help command, such as Minecraft's, which lists them without
+// separators, or Starbound's, which separates them with commas.
+func parseSlashCommands(resp string) []string {
+	var names []string
+	for _, m := range slashCommand.FindAllStringSubmatch(resp, -1) {
+		names = append(names, m[1])
+	}
+
+	return names
+}
+
+// uniqueSorted returns names sorted with duplicates removed.
+func uniqueSorted(names []string) []string {
+	sort.Strings(names)
+	unique := names[:0]
+	for _, name := range names {
+		if len(unique) == 0 || name != unique[len(unique)-1] {
+			unique = append(unique, name)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,116 @@
+package source
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientListCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		flavour string
+		cmd     string
+		resp    string
+		expect  []string
+		err     error
+	}{
+		{
+			name: "source",
+			cmd:  "cmdlist",
+			resp: "Command List\n--------------\n" +
+				"status                                   : cmd      :                  : Display map and connection status.\n" +
+				"changelevel                              : cmd      : sv               : Change server to the specified map\n" +
+				"_autosave                                : cmd      :                  : Autosave\n" +
+				"--------------\n  3 total commands\n",
+			expect: []string{"_autosave", "changelevel", "status"},
+		},
+		{
+			name:    "minecraft",
+			flavour: "minecraft",
+			cmd:     "help",
+			resp:    "/advancement (grant|revoke)/attribute <target> <attribute>/ban <targets> [<reason>]/ban-ip <target>/help [<command>]",
+			expect:  []string{"advancement", "attribute", "ban", "ban-ip", "help"},
+		},
+		{
+			name:    "starbound",
+			flavour: "starbound",
+			cmd:     "help",
+			resp:    "Basic commands are: /help, /nick, /whereami. Admin commands are: /admin, /help",
+			expect:  []string{"admin", "help", "nick", "whereami"},
+		},
+		{
+			name:    "unreal",
+			flavour: "unreal",
+			err:     ErrUnsupportedByFlavour,
+		},
+		{
+			name: "unsupported",
+			cmd:  "cmdlist",
+			resp: "Unknown command \"cmdlist\"",
+			err:  ErrCommandNotSupported("cmdlist"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerStopped(t)
+			if s == nil {
+				return
+			}
+			if tc.cmd != "" {
+				s.responses[fmt.Sprintf("%v:%v", execCommand, tc.cmd)] = []*pkt{newPkt(responseValue, 0, tc.resp)}
+			}
+			s.Start()
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			opts := []func(*Client) error{Timeout(time.Second * 2), DisableMultiPacket()}
+			if tc.flavour != "" {
+				opts = append(opts, Flavour(tc.flavour))
+			}
+			c, err := NewClient(s.Addr, opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			names, err := c.ListCommands()
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, names)
+		})
+	}
+}
+
+func TestClientFlavourCmdUnknownCommand(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	// The mock server reports commands it doesn't know as unknown, which
+	// DetectUnknownCommand turns into ErrUnknownCommand.
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DetectUnknownCommand())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	_, err = c.ServerInfo()
+	assert.ErrorIs(t, err, ErrCommandNotSupported("stats"))
+	assert.NotErrorIs(t, err, ErrUnknownCommand("stats"))
+}
@@ -14,11 +14,174 @@ var (
 
 	// ErrAuthFailure is returned if the client failed to authenticate.
 	ErrAuthFailure = errors.New("source: authentication failure")
+
+	// ErrPacketSize is returned when writing a packet whose size doesn't match
+	// its body.
+	ErrPacketSize = errors.New("source: packet size mismatch")
+
+	// ErrCommandTooLarge is returned if a command exceeds the maximum command
+	// size configured by WithMaxCommandSize.
+	ErrCommandTooLarge = errors.New("source: command too large")
+
+	// ErrDryRun is returned by methods which require a connection to the
+	// server when the client is in dry-run mode.
+	ErrDryRun = errors.New("source: dry-run mode")
+
+	// ErrUnsupportedTransport is returned if a feature which depends on the
+	// default TCP connection is used with a custom Transport.
+	ErrUnsupportedTransport = errors.New("source: unsupported by transport")
+
+	// ErrBackendDead is returned by NewClient if the liveness check enabled by
+	// WithLivenessCheck finds the server closed the connection.
+	ErrBackendDead = errors.New("source: backend dead")
+
+	// ErrResponseTooLarge is returned if a response exceeds the maximum
+	// response size configured by WithMaxResponseSize.
+	ErrResponseTooLarge = errors.New("source: response too large")
+
+	// ErrRateLimited is returned if the server replied to authentication with
+	// a banner indicating the client is connecting too frequently.
+	ErrRateLimited = errors.New("source: rate limited")
+
+	// ErrBanned is returned if the server replied to authentication with a
+	// banner indicating the client is banned.
+	ErrBanned = errors.New("source: banned")
+
+	// ErrReplayMismatch is returned by the Transport returned by
+	// ReplayTransport if a packet written doesn't match the recording.
+	ErrReplayMismatch = errors.New("source: replay mismatch")
+
+	// ErrUnsupportedByFlavour is returned if a feature isn't supported by the
+	// flavour of the server.
+	ErrUnsupportedByFlavour = errors.New("source: unsupported by flavour")
+
+	// ErrConnPoisoned is returned by commands after a malformed response was
+	// received or a packet was only partly written, as the connection may no
+	// longer be in sync with the server. Reset must be called to reconnect.
+	ErrConnPoisoned = errors.New("source: connection poisoned")
+
+	// ErrQueueClosed is the error of the Result of commands enqueued by
+	// Enqueue which were cancelled by Close.
+	ErrQueueClosed = errors.New("source: queue closed")
+
+	// ErrTLSHandshake is returned if the TLS handshake enabled by WithTLS
+	// fails, wrapping the error of the handshake, so it can be distinguished
+	// from the failure of RCON authentication.
+	ErrTLSHandshake = errors.New("source: tls handshake")
+
+	// ErrPoolClosed is returned by Pool.Get if the pool is closed.
+	ErrPoolClosed = errors.New("source: pool closed")
+
+	// ErrPossiblyTruncated is returned along with the response if it may have
+	// been truncated by the server, see WithTruncationThreshold.
+	ErrPossiblyTruncated = errors.New("source: response possibly truncated")
+
+	// ErrClientClosed is returned by a ReconnectingClient which is closed.
+	ErrClientClosed = errors.New("source: client closed")
+
+	// ErrInvalidPassword is returned by ChangePassword if the password
+	// contains a double quote or semicolon, which the server console can't
+	// accept in an argument.
+	ErrInvalidPassword = errors.New("source: invalid password")
 )
 
+// AuthError is returned if the client failed to authenticate, detailing the
+// packet received from the server. An ID of -1 indicates the password was
+// rejected, other values indicate the server deviated from the protocol.
+// It matches ErrAuthFailure using errors.Is.
+type AuthError struct {
+	ID   int32
+	Type int32
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("%v: got id=%v type=%v", ErrAuthFailure, e.ID, e.Type)
+}
+
+// Is returns true if target is ErrAuthFailure.
+func (e *AuthError) Is(target error) bool {
+	return target == ErrAuthFailure
+}
+
+// NonASCIIError is returned if a command with non-ASCII characters is
+// attempted, detailing the first such character and its byte offset in the
+// command. It matches ErrNonASCII using errors.Is.
+type NonASCIIError struct {
+	Rune   rune
+	Offset int
+}
+
+func (e *NonASCIIError) Error() string {
+	return fmt.Sprintf("%v: %q at offset %v", ErrNonASCII, e.Rune, e.Offset)
+}
+
+// Is returns true if target is ErrNonASCII.
+func (e *NonASCIIError) Is(target error) bool {
+	return target == ErrNonASCII
+}
+
+// BannerError is returned if the server replied to authentication with a
+// banner matching one of the configured BannerPatterns. Err is the error of
+// the matching pattern.
+type BannerError struct {
+	Banner string
+	Err    error
+}
+
+func (e *BannerError) Error() string {
+	return fmt.Sprintf("%v: %q", e.Err, e.Banner)
+}
+
+// Unwrap returns the error of the matching pattern.
+func (e *BannerError) Unwrap() error {
+	return e.Err
+}
+
 // ErrMalformedResponse is returned if the response from the server is malformed.
 type ErrMalformedResponse string
 
 func (e ErrMalformedResponse) Error() string {
 	return fmt.Sprintf("source: malformed response %v", string(e))
 }
+
+// ErrUnknownCommand is returned by ExecCmd if the server reported the command
+// as unknown and unknown command detection is enabled. Its value is the name of
+// the command.
+type ErrUnknownCommand string
+
+func (e ErrUnknownCommand) Error() string {
+	return fmt.Sprintf("source: unknown command %q", string(e))
+}
+
+// ErrCommandNotSupported is returned by flavour helpers, such as ServerInfo,
+// if the server reports a command they depend on as unknown. Its value is the
+// name of the command.
+type ErrCommandNotSupported string
+
+func (e ErrCommandNotSupported) Error() string {
+	return fmt.Sprintf("source: command %q not supported by server", string(e))
+}
+
+// PartialError is returned if an error occurs after part of a multi-packet
+// response has been received. Body is the part of the response received.
+type PartialError struct {
+	Body string
+	Err  error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("source: partial response (%v bytes): %v", len(e.Body), e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// ErrUnknownFlavour is returned if a server flavour isn't supported. Its value
+// is the name of the flavour.
+type ErrUnknownFlavour string
+
+func (e ErrUnknownFlavour) Error() string {
+	return fmt.Sprintf("source: unknown flavour %q", string(e))
+}
@@ -0,0 +1,74 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultExecAllConcurrency is the number of servers ExecAll queries at once
+// if no limit is given.
+const DefaultExecAllConcurrency = 10
+
+// Result is the outcome of running a command on one of the servers queried by
+// ExecAll.
+type Result struct {
+	// Response is the response to the command.
+	Response string
+
+	// Err is the error connecting to the server or running the command, if any.
+	Err error
+}
+
+// ExecAll connects to each of addrs, runs cmd and closes the connection,
+// returning the Result for each address. At most concurrency servers are
+// queried at once, if it's less than one DefaultExecAllConcurrency is used.
+// Each client is created with options, which are applied to every client so
+// must be safe to share between them. Cancelling ctx cancels the whole batch,
+// with the servers not yet queried reporting an error wrapping that of ctx.
+func ExecAll(ctx context.Context, addrs []string, cmd *Cmd, concurrency int, options ...func(c *Client) error) map[string]Result {
+	if concurrency < 1 {
+		concurrency = DefaultExecAllConcurrency
+	}
+
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]Result, len(addrs))
+	sem := make(chan struct{}, concurrency)
+	for _, addr := range addrs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			mtx.Lock()
+			results[addr] = Result{Err: fmt.Errorf("source: connect %v: %w", addr, ctx.Err())}
+			mtx.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			r := execOne(ctx, addr, cmd, options)
+			mtx.Lock()
+			results[addr] = r
+			mtx.Unlock()
+			<-sem
+		}(addr)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// execOne runs cmd on the server at addr for ExecAll.
+func execOne(ctx context.Context, addr string, cmd *Cmd, options []func(c *Client) error) Result {
+	opts := append(append([]func(c *Client) error(nil), options...), WithContext(ctx))
+	c, err := Open(ctx, addr, opts...)
+	if err != nil {
+		return Result{Err: err}
+	}
+	defer c.Close() // nolint: errcheck
+
+	resp, err := c.ExecCmd(cmd)
+	return Result{Response: resp, Err: err}
+}
@@ -0,0 +1,45 @@
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecAll(t *testing.T) {
+	s1 := newServer(t)
+	if s1 == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s1.Close())
+	}()
+
+	s2 := newServer(t)
+	if s2 == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s2.Close())
+	}()
+
+	bad := "127.0.0.1:1"
+	results := ExecAll(context.Background(), []string{s1.Addr, s2.Addr, bad}, NewCmd("echo").WithArgs("test me"), 2, Timeout(time.Second*2))
+	assert.Len(t, results, 3)
+	for _, addr := range []string{s1.Addr, s2.Addr} {
+		assert.NoError(t, results[addr].Err)
+		assert.Equal(t, "test me", results[addr].Response)
+	}
+	assert.Error(t, results[bad].Err)
+
+	// A cancelled context cancels the whole batch.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results = ExecAll(ctx, []string{s1.Addr, s2.Addr}, NewCmd("echo").WithArgs("test me"), 0)
+	assert.Len(t, results, 2)
+	for _, addr := range []string{s1.Addr, s2.Addr} {
+		assert.ErrorIs(t, results[addr].Err, context.Canceled)
+	}
+}
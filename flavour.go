@@ -0,0 +1,226 @@
+package source
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"time"
+)
+
+// detectTimeout is the maximum time AutoDetectServer waits for a reply to its
+// probe.
+const detectTimeout = time.Second
+
+// flavour describes the quirks of a server implementation.
+type flavour struct {
+	// options returns the default options for the flavour.
+	options func() []func(*Client) error
+
+	// listCmd is the command which lists the commands of the server, if any.
+	listCmd string
+
+	// parseCommands returns the command names from the response to listCmd.
+	parseCommands func(resp string) []string
+
+	// serverInfo returns the server info, if supported.
+	serverInfo func(c *Client, f flavour) (*ServerInfo, error)
+
+	// unknownCmd are the lower case prefixes of the responses used by the
+	// server to report an unknown command, if not the defaults.
+	unknownCmd []string
+}
+
+// flavours is the registry of supported server flavours.
+var flavours = map[string]flavour{
+	"source": {
+		options: func() []func(*Client) error {
+			return nil
+		},
+		listCmd:       "cmdlist",
+		parseCommands: parseCmdlist,
+		serverInfo:    sourceServerInfo,
+		unknownCmd:    []string{"unknown command"},
+	},
+	"minecraft": {
+		options: func() []func(*Client) error {
+			return []func(*Client) error{DisableMultiPacket(), WithDefaultPort(25575)}
+		},
+		listCmd:       "help",
+		parseCommands: parseSlashCommands,
+		serverInfo:    minecraftServerInfo,
+		unknownCmd:    []string{"unknown or incomplete command", "unknown command"},
+	},
+	"starbound": {
+		options: func() []func(*Client) error {
+			return []func(*Client) error{DisableMultiPacket(), WithDefaultPort(21026)}
+		},
+		listCmd:       "help",
+		parseCommands: parseSlashCommands,
+	},
+	"unreal": {
+		options: func() []func(*Client) error {
+			// Request IDs start at 1 so responses can't be confused with
+			// keepalives.
+			return []func(*Client) error{dropKeepalives(), WithInitialRequestID(1)}
+		},
+	},
+}
+
+// Flavours returns the sorted names of the supported server flavours.
+func Flavours() []string {
+	names := make([]string, 0, len(flavours))
+	for name := range flavours {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// FlavourDefaults returns the default options for the named server flavour.
+// If the flavour isn't supported it returns ErrUnknownFlavour.
+func FlavourDefaults(name string) ([]func(*Client) error, error) {
+	f, ok := flavours[name]
+	if !ok {
+		return nil, ErrUnknownFlavour(name)
+	}
+
+	return f.options(), nil
+}
+
+// Flavour configures a source rcon Client for the named server flavour by
+// applying its default options, which can be overridden by later options.
+func Flavour(name string) func(*Client) error {
+	return func(c *Client) error {
+		opts, err := FlavourDefaults(name)
+		if err != nil {
+			return err
+		}
+
+		for _, f := range opts {
+			if err = f(c); err != nil {
+				return err
+			}
+		}
+		c.flavour = name
+
+		return nil
+	}
+}
+
+// currentFlavour returns the flavour configured or detected, or the source
+// flavour if none.
+func (c *Client) currentFlavour() flavour {
+	if f, ok := flavours[c.flavour]; ok {
+		return f
+	}
+	return flavours["source"]
+}
+
+// unsupported returns true if resp reports the command as unknown.
+func (f flavour) unsupported(resp string) bool {
+	if f.unknownCmd == nil {
+		return unknownCommand(resp)
+	}
+	return hasUnknownPrefix(resp, f.unknownCmd)
+}
+
+// execFlavourCmd executes cmd for a helper of flavour f, such as ServerInfo,
+// returning ErrCommandNotSupported if the server reports it as unknown, so
+// helpers don't parse the report as the response.
+func (c *Client) execFlavourCmd(f flavour, cmd *Cmd) (string, error) {
+	resp, err := c.ExecCmd(cmd)
+	var unknown ErrUnknownCommand
+	switch {
+	case errors.As(err, &unknown):
+		return "", c.execErr(cmd.redacted(), ErrCommandNotSupported(cmd.cmd))
+	case err != nil:
+		return "", err
+	case f.unsupported(resp):
+		return "", c.execErr(cmd.redacted(), ErrCommandNotSupported(cmd.cmd))
+	}
+
+	return resp, nil
+}
+
+// Unreal configures a source rcon Client for Unreal Engine based servers, such
+// as Conan Exiles, which send spurious empty responseValue packets with ID 0
+// as keepalives between responses. They are discarded rather than being
+// treated as part of a response. It's equivalent to Flavour("unreal").
+func Unreal() func(*Client) error {
+	return Flavour("unreal")
+}
+
+// dropKeepalives makes the client discard keepalive packets.
+func dropKeepalives() func(*Client) error {
+	return func(c *Client) error {
+		c.keepalives = true
+		return nil
+	}
+}
+
+// keepalive returns true if p is a keepalive packet sent by Unreal Engine
+// based servers.
+func keepalive(p *Packet) bool {
+	return p.ID == 0 && p.Type == responseValue && len(p.Body) == 0
+}
+
+// AutoDetectServer enables detection of the server software after
+// authenticating, applying the defaults of the detected flavour. Detection is
+// a best effort heuristic based on how the server replies to the empty
+// responseValue packet used to terminate multi-packet responses: Source based
+// servers echo it, Minecraft replies with "Unknown request", and if there's no
+// reply within a second the server is left undetected. See DetectedServer.
+func AutoDetectServer() func(*Client) error {
+	return func(c *Client) error {
+		c.autoDetect = true
+		return nil
+	}
+}
+
+// DetectedServer returns the flavour of server detected by AutoDetectServer,
+// or an empty string if it's disabled or the server wasn't recognised.
+func (c *Client) DetectedServer() string {
+	return c.detected
+}
+
+// detectServer probes the server to detect its flavour and applies its defaults.
+func (c *Client) detectServer() error {
+	c.detected = ""
+	name, err := c.probeLocked()
+	if err != nil || name == "" {
+		return err
+	}
+
+	if err = Flavour(name)(c); err != nil {
+		return err
+	}
+	c.detected = name
+
+	return nil
+}
+
+// readProbe reads the reply to the detection probe with id, returning the
+// name of the flavour it indicates, if any.
+func (c *Client) readProbe(id int32) (string, error) {
+	p, err := c.readPkt()
+	switch {
+	case err != nil && timeout(err):
+		return "", nil
+	case err != nil:
+		return "", err
+	case bytes.HasPrefix(p.body, unknownRequest):
+		return "minecraft", nil
+	case p.ID != id || len(p.body) != 0:
+		return "", nil
+	}
+
+	// Consume the second packet of the echo.
+	if p, err = c.readPkt(); err != nil {
+		return "", err
+	} else if p.ID != id || !bytes.Equal(p.body, responseBody) {
+		return "", nil
+	}
+
+	return "source", nil
+}
@@ -0,0 +1,128 @@
+package source
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlavours(t *testing.T) {
+	assert.Equal(t, []string{"minecraft", "source", "starbound", "unreal"}, Flavours())
+
+	for _, name := range Flavours() {
+		_, err := FlavourDefaults(name)
+		assert.NoError(t, err)
+	}
+
+	_, err := FlavourDefaults("unknown")
+	assert.Equal(t, ErrUnknownFlavour("unknown"), err)
+}
+
+func TestClientFlavour(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Flavour("minecraft"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	assert.False(t, c.MultiPacket())
+	assert.Equal(t, "minecraft", c.flavour)
+
+	_, err = NewClient(s.Addr, Flavour("unknown"))
+	assert.Equal(t, ErrUnknownFlavour("unknown"), err)
+}
+
+func TestAutoDetectServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		reply  []*pkt
+		expect string
+		multi  bool
+	}{
+		{"source", nil, "source", true},
+		{"minecraft", []*pkt{newPkt(responseValue, 0, "Unknown request 0")}, "minecraft", false},
+		{"silent", []*pkt{}, "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerStopped(t)
+			if s == nil {
+				return
+			}
+			if tc.reply != nil {
+				s.responses[fmt.Sprintf("%v:", responseValue)] = tc.reply
+			}
+			s.Start()
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			c, err := NewClient(s.Addr, Timeout(time.Millisecond*200), AutoDetectServer())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			assert.Equal(t, tc.expect, c.DetectedServer())
+			assert.Equal(t, tc.multi, c.MultiPacket())
+
+			if tc.multi && tc.expect != "" {
+				resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+				assert.NoError(t, err)
+				assert.Equal(t, "test me", resp)
+			}
+		})
+	}
+}
+
+func TestClientUnreal(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	// With a password the auth request has ID 1 and echo ID 2, as IDs start at
+	// 1, so the keepalives have their IDs offset to send them with ID 0.
+	keepalive := newPkt(responseValue, -2, "")
+	s.responses[fmt.Sprintf("%v:echo test me", execCommand)] = []*pkt{
+		keepalive,
+		newPkt(responseValue, 0, "test "),
+		keepalive,
+		newPkt(responseValue, 0, "me"),
+	}
+	s.responses[fmt.Sprintf("%v:", responseValue)] = []*pkt{
+		newPkt(responseValue, -3, ""),
+		newPkt(responseValue, 0, ""),
+		newPkt(responseValue, 0, string(responseBody)),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Password(testPassword), Unreal())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
@@ -0,0 +1,88 @@
+package source
+
+import (
+	"time"
+)
+
+// ExecUntilIdle executes cmd on the server and returns the combined bodies of
+// the response packets which arrive until the connection is idle for idle,
+// for servers which don't reliably terminate their responses. The first packet
+// is waited for up to the client timeout as usual.
+//
+// This trades latency, as every response takes at least idle to complete, for
+// robustness against missing terminators, so idle should be set just above the
+// gap the server leaves between the packets of a response.
+//
+// Aliases and middlewares aren't applied to commands executed by
+// ExecUntilIdle. If the client uses a custom Transport it returns
+// ErrUnsupportedTransport.
+func (c *Client) ExecUntilIdle(cmd *Cmd, idle time.Duration) (string, error) {
+	if c.dryRun {
+		return "", ErrDryRun
+	}
+
+	defer c.logSlow(cmd, c.now())
+
+	body, err := c.encode(cmd.String())
+	if err != nil {
+		return "", c.execErr(cmd.redacted(), err)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	resp, err := c.idleLocked(body, idle)
+	if err != nil {
+		// The response is returned with ErrPossiblyTruncated.
+		return resp, c.execErr(cmd.redacted(), c.ctxErr(err))
+	}
+
+	return resp, nil
+}
+
+// idleLocked executes body on the server and returns the combined bodies of
+// the response packets which arrive until the connection is idle. The caller
+// must hold c.mtx.
+func (c *Client) idleLocked(body string, idle time.Duration) (string, error) {
+	if !c.tcp() {
+		return "", ErrUnsupportedTransport
+	}
+
+	read := func(expectedID int32, onChunk func(body []byte) error) error {
+		return c.readUntilIdle(expectedID, idle, onChunk)
+	}
+
+	return c.collect(func(onChunk func(body []byte) error) error {
+		return c.sendLocked(body, c.writePkt, read, onChunk)
+	})
+}
+
+// readUntilIdle reads packets with expectedID calling onChunk with their
+// bodies until no packet arrives within idle of the previous one.
+func (c *Client) readUntilIdle(expectedID int32, idle time.Duration, onChunk func(body []byte) error) error {
+	var unexpected int
+	for received := false; ; {
+		if received {
+			if ok, err := c.waitPkt(idle); err != nil || !ok {
+				return err
+			}
+		}
+
+		p, err := c.readPkt()
+		if err != nil {
+			return err
+		}
+
+		if p.ID != expectedID || p.Type != responseValue {
+			if err = c.unexpectedPkt(p, &unexpected); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err = onChunk(p.body); err != nil {
+			return err
+		}
+		received = true
+	}
+}
@@ -0,0 +1,45 @@
+package source
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientExecUntilIdle(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:drip", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "line 1\n"),
+		newPkt(responseValue, 0, "line 2\n"),
+		newPkt(responseValue, 0, "line 3\n"),
+	}
+	s.delay = time.Millisecond * 20
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecUntilIdle(NewCmd("drip"), time.Millisecond*500)
+	assert.NoError(t, err)
+	assert.Equal(t, "line 1\nline 2\nline 3\n", resp)
+
+	resp, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	_, err = c.ExecUntilIdle(NewCmd("badé"), time.Millisecond*500)
+	assert.ErrorIs(t, err, ErrNonASCII)
+}
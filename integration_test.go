@@ -4,6 +4,7 @@ package source
 
 import (
 	"flag"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,7 +14,14 @@ import (
 var (
 	serverAddress  = flag.String("server-address", "127.0.0.1", "sets the servers address for integration tests")
 	serverPassword = flag.String("server-password", "", "sets the rcon password for integration tests")
-	serverFlavour  = flag.String("server-flavour", "source", "configures the flavour <source|minecraft|starbound> of integration tests")
+	serverFlavour  = flag.String("server-flavour", "source", "configures the flavour <"+strings.Join(Flavours(), "|")+"> of integration tests")
+
+	flavourTests = map[string]func(c *Client) []subtest{
+		"source":    sourceTests,
+		"minecraft": minecraftTests,
+		"starbound": starboundTests,
+		"unreal":    unrealTests,
+	}
 )
 
 type subtest struct {
@@ -68,18 +76,25 @@ func starboundTests(c *Client) []subtest {
 	}
 }
 
+func unrealTests(c *Client) []subtest {
+	return []subtest{
+		{"unreal-listplayers", func(t *testing.T) {
+			r, err := c.ExecCmd(NewCmd("listplayers"))
+			assert.NoError(t, err)
+			assert.NotEmpty(t, r)
+		}},
+	}
+}
+
 func TestIntegration(t *testing.T) {
-	opts := []func(*Client) error{Timeout(time.Second * 10)}
-	if *serverPassword != "" {
-		opts = append(opts, Password(*serverPassword))
+	opts, err := FlavourDefaults(*serverFlavour)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	switch *serverFlavour {
-	case "source":
-	case "minecraft", "starbound":
-		opts = append(opts, DisableMultiPacket())
-	default:
-		t.Fatal("unsupported flavour", *serverFlavour)
+	opts = append(opts, Timeout(time.Second*10))
+	if *serverPassword != "" {
+		opts = append(opts, Password(*serverPassword))
 	}
 
 	c, err := NewClient(*serverAddress, opts...)
@@ -90,17 +105,13 @@ func TestIntegration(t *testing.T) {
 		assert.NoError(t, c.Close())
 	}()
 
-	var tests []subtest
-	switch *serverFlavour {
-	case "source":
-		tests = sourceTests(c)
-	case "minecraft":
-		tests = minecraftTests(c)
-	case "starbound":
-		tests = starboundTests(c)
+	for _, tc := range flavourTests[*serverFlavour](c) {
+		t.Run(tc.name, tc.f)
 	}
+}
 
-	for _, tc := range tests {
-		t.Run(tc.name, tc.f)
+func TestIntegrationFlavours(t *testing.T) {
+	for _, name := range Flavours() {
+		assert.Contains(t, flavourTests, name)
 	}
 }
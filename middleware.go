@@ -0,0 +1,123 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ExecFunc executes cmd and returns the response.
+type ExecFunc func(ctx context.Context, cmd *Cmd) (string, error)
+
+// Middleware wraps an ExecFunc to add behaviour such as logging, metrics,
+// retries or rate limiting to the execution of commands.
+type Middleware func(next ExecFunc) ExecFunc
+
+// Use adds middlewares to the chain which ExecCmd runs commands through. The
+// chain is built once by NewClient, with the first middleware outermost.
+func Use(middlewares ...Middleware) func(*Client) error {
+	return func(c *Client) error {
+		for _, m := range middlewares {
+			if m == nil {
+				return ErrNilOption
+			}
+		}
+		c.middlewares = append(c.middlewares, middlewares...)
+		return nil
+	}
+}
+
+// LoggingMiddleware returns a Middleware which logs each command, how long it
+// took and any error using the printf style logf. The arguments of commands
+// which set passwords are redacted.
+func LoggingMiddleware(logf func(format string, args ...interface{})) Middleware {
+	return func(next ExecFunc) ExecFunc {
+		return func(ctx context.Context, cmd *Cmd) (string, error) {
+			start := time.Now()
+			resp, err := next(ctx, cmd)
+			if err != nil {
+				logf("source: exec %q failed after %v: %v", cmd.redacted(), time.Since(start), err)
+			} else {
+				logf("source: exec %q took %v", cmd.redacted(), time.Since(start))
+			}
+			return resp, err
+		}
+	}
+}
+
+// MetricsMiddleware returns a Middleware which calls observe with each
+// command, how long it took and its error, if any.
+func MetricsMiddleware(observe func(cmd *Cmd, d time.Duration, err error)) Middleware {
+	return func(next ExecFunc) ExecFunc {
+		return func(ctx context.Context, cmd *Cmd) (string, error) {
+			start := time.Now()
+			resp, err := next(ctx, cmd)
+			observe(cmd, time.Since(start), err)
+			return resp, err
+		}
+	}
+}
+
+// RetryMiddleware returns a Middleware which makes up to attempts attempts to
+// execute each command, waiting delay between each. Errors which retrying
+// can't fix, such as ErrNonASCII, and context errors aren't retried.
+func RetryMiddleware(attempts int, delay time.Duration) Middleware {
+	return func(next ExecFunc) ExecFunc {
+		return func(ctx context.Context, cmd *Cmd) (resp string, err error) {
+			for i := 1; ; i++ {
+				if resp, err = next(ctx, cmd); err == nil || i >= attempts || !retryable(err) {
+					return resp, err
+				}
+
+				select {
+				case <-ctx.Done():
+					return "", ctx.Err()
+				case <-time.After(delay):
+				}
+			}
+		}
+	}
+}
+
+// retryable returns true if retrying a command which failed with err may
+// succeed.
+func retryable(err error) bool {
+	var unknown ErrUnknownCommand
+	switch {
+	case errors.Is(err, ErrNonASCII),
+		errors.Is(err, ErrCommandTooLarge),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &unknown):
+		return false
+	}
+	return true
+}
+
+// RateLimitMiddleware returns a Middleware which ensures commands are started
+// at least interval apart, delaying them as necessary.
+func RateLimitMiddleware(interval time.Duration) Middleware {
+	var mtx sync.Mutex
+	var next time.Time
+	return func(exec ExecFunc) ExecFunc {
+		return func(ctx context.Context, cmd *Cmd) (string, error) {
+			mtx.Lock()
+			now := time.Now()
+			start := next
+			if start.Before(now) {
+				start = now
+			}
+			next = start.Add(interval)
+			mtx.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(start.Sub(now)):
+			}
+
+			return exec(ctx, cmd)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientUse(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(next ExecFunc) ExecFunc {
+			return func(ctx context.Context, cmd *Cmd) (string, error) {
+				calls = append(calls, name+":"+cmd.String())
+				return next(ctx, cmd)
+			}
+		}
+	}
+
+	var logged []string
+	logf := func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Use(mw("a"), mw("b")), Use(LoggingMiddleware(logf)))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	assert.Equal(t, []string{"a:echo test me", "b:echo test me"}, calls)
+	if assert.Len(t, logged, 1) {
+		assert.Contains(t, logged[0], `exec "echo test me" took`)
+	}
+
+	_, err = NewClient(s.Addr, Use(nil))
+	assert.Equal(t, ErrNilOption, err)
+}
+
+func TestLoggingMiddlewareRedacted(t *testing.T) {
+	var logged []string
+	logf := func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	}
+	exec := LoggingMiddleware(logf)(func(ctx context.Context, cmd *Cmd) (string, error) {
+		return "", nil
+	})
+
+	for _, cmd := range []*Cmd{
+		NewCmd("rcon_password").WithArgs("newsecret"),
+		NewCmd("sv_password").WithArgs(Quote("newsecret")),
+		NewCmd("rcon_password newsecret"),
+	} {
+		_, err := exec(context.Background(), cmd)
+		assert.NoError(t, err)
+	}
+
+	if assert.Len(t, logged, 3) {
+		for _, l := range logged {
+			assert.NotContains(t, l, "newsecret")
+			assert.Contains(t, l, "<redacted>")
+		}
+	}
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	errTest := errors.New("test")
+	var observed error
+	exec := MetricsMiddleware(func(cmd *Cmd, d time.Duration, err error) {
+		observed = err
+	})(func(ctx context.Context, cmd *Cmd) (string, error) {
+		return "", errTest
+	})
+
+	_, err := exec(context.Background(), NewCmd("status"))
+	assert.Equal(t, errTest, err)
+	assert.Equal(t, errTest, observed)
+}
+
+func TestRetryMiddleware(t *testing.T) {
+	errTemp := errors.New("temporary")
+	tests := []struct {
+		name  string
+		errs  []error
+		calls int
+		err   error
+	}{
+		{"success", []error{nil}, 1, nil},
+		{"recovers", []error{errTemp, errTemp, nil}, 3, nil},
+		{"exhausted", []error{errTemp, errTemp, errTemp, nil}, 3, errTemp},
+		{"permanent", []error{ErrNonASCII, nil}, 1, ErrNonASCII},
+		{"unknown-command", []error{ErrUnknownCommand("x"), nil}, 1, ErrUnknownCommand("x")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int
+			exec := RetryMiddleware(3, time.Millisecond)(func(ctx context.Context, cmd *Cmd) (string, error) {
+				err := tc.errs[calls]
+				calls++
+				return "", err
+			})
+
+			_, err := exec(context.Background(), NewCmd("status"))
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.calls, calls)
+		})
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	exec := RateLimitMiddleware(time.Millisecond * 50)(func(ctx context.Context, cmd *Cmd) (string, error) {
+		return "", nil
+	})
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := exec(context.Background(), NewCmd("status"))
+		assert.NoError(t, err)
+	}
+	assert.True(t, time.Since(start) >= time.Millisecond*100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := exec(ctx, NewCmd("status"))
+	assert.Equal(t, context.Canceled, err)
+}
@@ -0,0 +1,63 @@
+package source
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// minecraftColour matches Minecraft formatting codes, such as §a.
+	minecraftColour = regexp.MustCompile("§.")
+
+	// minecraftList matches the player counts of the output of the Minecraft
+	// list command, in the formats of vanilla and common server software:
+	//   There are 3 of a max of 20 players online: ...
+	//   There are 3/20 players online: ...
+	//   There are 3 out of maximum 20 players online.
+	minecraftList = regexp.MustCompile(`(?i)there (?:are|is) (\d+)(?: of a max(?: of)? |/| out of maximum )(\d+) players? online[.:]?`)
+
+	// minecraftGroup matches the group prefix of a line of players, such as
+	// "default: " as listed by Essentials.
+	minecraftGroup = regexp.MustCompile(`^[\w ]+: `)
+)
+
+// StripMinecraftColours returns s with the Minecraft formatting codes, such as
+// §a, removed.
+func StripMinecraftColours(s string) string {
+	return minecraftColour.ReplaceAllString(s, "")
+}
+
+// ParseMinecraftList parses the output of the Minecraft list command, such as
+// "There are 3 of a max of 20 players online: Alice, Bob, Carol", returning the
+// number of players online, the maximum and the names of the players online.
+// Formatting codes are stripped first. The formats used by vanilla servers and
+// common server software, including those which list players by group on
+// separate lines, are supported. If raw isn't recognised it returns
+// ErrMalformedResponse.
+func ParseMinecraftList(raw string) (online, max int, names []string, err error) {
+	raw = StripMinecraftColours(raw)
+	m := minecraftList.FindStringSubmatchIndex(raw)
+	if m == nil {
+		return 0, 0, nil, ErrMalformedResponse("unrecognised minecraft list")
+	}
+
+	// The counts only contain digits, so can't fail to parse unless huge.
+	if online, err = strconv.Atoi(raw[m[2]:m[3]]); err != nil {
+		return 0, 0, nil, ErrMalformedResponse("invalid minecraft list count")
+	}
+	if max, err = strconv.Atoi(raw[m[4]:m[5]]); err != nil {
+		return 0, 0, nil, ErrMalformedResponse("invalid minecraft list max")
+	}
+
+	for _, line := range strings.Split(raw[m[1]:], "\n") {
+		line = minecraftGroup.ReplaceAllString(strings.TrimSpace(line), "")
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return online, max, names, nil
+}
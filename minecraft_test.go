@@ -0,0 +1,38 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMinecraftList(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		online int
+		max    int
+		names  []string
+	}{
+		{"vanilla", "There are 3 of a max of 20 players online: Alice, Bob, Carol", 3, 20, []string{"Alice", "Bob", "Carol"}},
+		{"vanilla-empty", "There are 0 of a max of 20 players online: ", 0, 20, nil},
+		{"vanilla-old", "There are 2/10 players online:Alice, Bob", 2, 10, []string{"Alice", "Bob"}},
+		{"vanilla-no-of", "There are 1 of a max 5 players online: Alice\n", 1, 5, []string{"Alice"}},
+		{"colours", "§6There are §c2§6 out of maximum §c50§6 players online.\n§6default§r: §fAlice§f, §fBob", 2, 50, []string{"Alice", "Bob"}},
+		{"groups", "There are 3 out of maximum 50 players online.\nadmins: Alice\ndefault: Bob, Carol\n", 3, 50, []string{"Alice", "Bob", "Carol"}},
+		{"plugin-empty", "There are 0 out of maximum 50 players online.", 0, 50, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			online, max, names, err := ParseMinecraftList(tc.raw)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.online, online)
+			assert.Equal(t, tc.max, max)
+			assert.Equal(t, tc.names, names)
+		})
+	}
+
+	_, _, _, err := ParseMinecraftList("Unknown command")
+	assert.ErrorAs(t, err, new(ErrMalformedResponse))
+}
@@ -1,20 +1,35 @@
 package source
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+const (
+	// testPassword is the rcon password accepted by the mock server.
+	testPassword = "secret"
+)
+
+// errHangup is returned by write when the server should hang up.
+var errHangup = errors.New("hangup")
+
 var (
 	commands = map[string][]*pkt{
+		fmt.Sprintf("%v:%v", auth, testPassword): {
+			newPkt(responseValue, 0, ""),
+			newPkt(authResponse, 0, ""),
+		},
 		fmt.Sprintf("%v:echo test me", execCommand): {newPkt(responseValue, 0, "test me")},
 		fmt.Sprintf("%v:", responseValue): {
-			newPkt(responseValue, 1, ""),
-			newPkt(responseValue, 1, string(responseBody)),
+			newPkt(responseValue, 0, ""),
+			newPkt(responseValue, 0, string(responseBody)),
 		},
 	}
 )
@@ -40,7 +55,12 @@ type server struct {
 	done     chan struct{}
 	wg       sync.WaitGroup
 	failConn bool
-	mtx      sync.Mutex
+	// requireAuth closes connections which execute a command before they
+	// have authenticated.
+	requireAuth bool
+	delay       time.Duration
+	responses   map[string][]*pkt
+	mtx         sync.Mutex
 }
 
 // sconn represents a server connection
@@ -64,11 +84,17 @@ func newServerStopped(t *testing.T) *server {
 		return nil
 	}
 
+	return newServerListener(t, l)
+}
+
+// newServerListener returns a stopped server using listener l.
+func newServerListener(t *testing.T, l net.Listener) *server {
 	s := &server{
-		Listener: l,
-		conns:    make(map[net.Conn]struct{}),
-		done:     make(chan struct{}),
-		t:        t,
+		Listener:  l,
+		conns:     make(map[net.Conn]struct{}),
+		done:      make(chan struct{}),
+		responses: make(map[string][]*pkt),
+		t:         t,
 	}
 	s.Addr = s.Listener.Addr().String()
 	return s
@@ -96,11 +122,19 @@ func (s *server) serve() {
 	}
 }
 
-// write writes msg to conn.
+// write writes pkts to conn, the ID of each packet is relative to id.
+// A nil packet causes the server to hang up, see hangup.
 func (s *server) write(conn net.Conn, id int32, pkts []*pkt) error {
 	for _, p := range pkts {
-		p.ID = id
-		_, err := p.WriteTo(conn)
+		if s.delay > 0 {
+			time.Sleep(s.delay)
+		}
+		if p == nil {
+			return errHangup
+		}
+		p2 := *p
+		p2.ID += id
+		_, err := p2.WriteTo(conn)
 		if s.running() {
 			assert.NoError(s.t, err)
 		}
@@ -137,22 +171,62 @@ func (s *server) handle(conn net.Conn) {
 	}
 
 	c := &sconn{Conn: conn}
+	var authed bool
 	for {
 		p := &pkt{}
 		if _, err := p.ReadFrom(conn); err != nil {
 			return
+		} else if p.Type == execCommand && s.requireAuth && !authed {
+			return
 		}
 
-		cmd := fmt.Sprintf("%v:%v", p.Type, p.Body())
-		resp, ok := commands[cmd]
-		if !ok {
-			resp = []*pkt{newPkt(responseValue, p.ID, fmt.Sprintf("unknown command %v", cmd))}
-		}
-
-		if err := s.write(c, p.ID, resp); err != nil {
+		ok, err := s.respond(c, p)
+		if err != nil {
+			if err == errHangup {
+				hangup(conn)
+			}
 			return
 		}
+		authed = authed || ok
+	}
+}
+
+// response returns the response to p and true if it's a known command, or a
+// response reporting it as unknown and false otherwise.
+func (s *server) response(p *pkt) ([]*pkt, bool) {
+	cmd := fmt.Sprintf("%v:%v", p.Type, p.Body())
+	if resp, ok := s.responses[cmd]; ok {
+		return resp, true
+	} else if resp, ok = commands[cmd]; ok {
+		return resp, true
+	}
+
+	return []*pkt{newPkt(responseValue, 0, fmt.Sprintf("unknown command %v", cmd))}, false
+}
+
+// respond writes the response to p to conn, returning true if p successfully
+// authenticated the connection.
+func (s *server) respond(conn net.Conn, p *pkt) (bool, error) {
+	resp, ok := s.response(p)
+	if ok || p.Type != auth {
+		return ok && p.Type == auth, s.write(conn, p.ID, resp)
+	}
+
+	// Bad password, the auth response has an ID of -1.
+	if err := s.write(conn, p.ID, []*pkt{newPkt(responseValue, 0, "")}); err != nil {
+		return false, err
+	}
+
+	return false, s.write(conn, -1, []*pkt{newPkt(authResponse, 0, "")})
+}
+
+// hangup cleanly closes the server side of conn, then discards anything else
+// the client sends until it closes, so the connection isn't reset.
+func hangup(conn net.Conn) {
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.CloseWrite() // nolint: errcheck
 	}
+	io.Copy(io.Discard, conn) // nolint: errcheck
 }
 
 // closeConn closes a client connection and removes it from our map of connections.
@@ -0,0 +1,99 @@
+package source
+
+import (
+	"time"
+)
+
+// drainIdle is the time SupportsMultiPacket waits for stray packets to arrive
+// after its probe.
+const drainIdle = time.Millisecond * 100
+
+// SupportsMultiPacket reports whether the server supports multi-packet
+// responses, by sending the empty responseValue packet used to terminate them
+// and checking whether the server echoes it, as Source based servers do. No
+// command is executed and the mode of the client isn't changed, so tooling
+// can use it to decide whether to use DisableMultiPacket. If the server
+// doesn't reply within a second it's assumed not to support them. Any packets
+// which arrive after the probe are discarded using Drain.
+//
+// If the client uses a custom Transport it returns ErrUnsupportedTransport.
+func (c *Client) SupportsMultiPacket() (bool, error) {
+	if c.dryRun {
+		return false, ErrDryRun
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.tcp() {
+		return false, ErrUnsupportedTransport
+	}
+
+	name, err := c.probeLocked()
+	if err != nil {
+		return false, c.ctxErr(err)
+	}
+
+	if err = c.drainLocked(drainIdle); err != nil {
+		return false, c.ctxErr(err)
+	}
+
+	return name == "source", nil
+}
+
+// probeLocked sends the detection probe and returns the name of the flavour
+// its reply indicates, if any. The caller must hold c.mtx.
+func (c *Client) probeLocked() (string, error) {
+	c.deadline = c.now().Add(detectTimeout)
+	if c.timeout < detectTimeout {
+		c.deadline = c.now().Add(c.timeout)
+	}
+	defer func() {
+		c.deadline = time.Time{}
+	}()
+
+	id := c.reqID
+	if err := c.writePkt(responseValue, ""); err != nil {
+		return "", err
+	}
+
+	return c.readProbe(id)
+}
+
+// Drain discards any packets which arrive from the server until none arrives
+// within idle, such as the remainder of a response which was abandoned, so the
+// connection can be used again without a Reset.
+//
+// If the client uses a custom Transport it returns ErrUnsupportedTransport.
+func (c *Client) Drain(idle time.Duration) error {
+	if c.dryRun {
+		return ErrDryRun
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.tcp() {
+		return ErrUnsupportedTransport
+	}
+
+	if err := c.drainLocked(idle); err != nil {
+		return c.ctxErr(err)
+	}
+
+	return nil
+}
+
+// drainLocked discards packets until none arrives within idle. The caller
+// must hold c.mtx.
+func (c *Client) drainLocked(idle time.Duration) error {
+	for {
+		if ok, err := c.waitPkt(idle); err != nil || !ok {
+			return err
+		}
+
+		if _, err := c.readPkt(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientSupportsMultiPacket(t *testing.T) {
+	tests := []struct {
+		name   string
+		reply  []*pkt
+		expect bool
+	}{
+		{"source", nil, true},
+		{"minecraft", []*pkt{newPkt(responseValue, 0, "Unknown request 0")}, false},
+		{"silent", []*pkt{}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerStopped(t)
+			if s == nil {
+				return
+			}
+			if tc.reply != nil {
+				s.responses[fmt.Sprintf("%v:", responseValue)] = tc.reply
+			}
+			s.Start()
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			c, err := NewClient(s.Addr, Timeout(time.Millisecond*200), DisableMultiPacket())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			ok, err := c.SupportsMultiPacket()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, ok)
+			assert.False(t, c.MultiPacket())
+
+			resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+			assert.NoError(t, err)
+			assert.Equal(t, "test me", resp)
+		})
+	}
+}
+
+func TestClientDrain(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:long", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "line 1"),
+		newPkt(responseValue, 0, "line 2"),
+		newPkt(responseValue, 0, "line 3"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	errStop := errors.New("stop")
+	err = c.ExecCallback(NewCmd("long"), func([]byte) error {
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+
+	assert.NoError(t, c.Drain(time.Millisecond*100))
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	c2, err := NewClient(s.Addr, WithTransport(&memTransport{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.ErrorIs(t, c2.Drain(time.Millisecond), ErrUnsupportedTransport)
+	_, err = c2.SupportsMultiPacket()
+	assert.ErrorIs(t, err, ErrUnsupportedTransport)
+}
@@ -0,0 +1,50 @@
+package source
+
+import (
+	"context"
+	"fmt"
+)
+
+// Open returns a new source rcon client connected to addr, like NewClient,
+// except ctx bounds the entire sequence of dialing and authenticating with
+// the server, rather than just the dial. Once Open returns ctx no longer
+// affects the client, use WithContext to bind the lifetime of the connection
+// to a context.
+//
+// Open is the recommended constructor for context aware applications.
+func Open(ctx context.Context, addr string, options ...func(c *Client) error) (*Client, error) {
+	opts := append(options[:len(options):len(options)], func(c *Client) error {
+		c.connectCtx = ctx
+		return nil
+	})
+	c, err := NewClient(addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.connectCtx = nil
+	c.options = options
+
+	return c, nil
+}
+
+// watchConnect closes the connection if ctx is done before the returned func
+// is called, in which case the func returns the error of ctx wrapped.
+func (c *Client) watchConnect(ctx context.Context) func() error {
+	conn := c.conn
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close() // nolint: errcheck
+			done <- fmt.Errorf("source: connect %v: %w", c.server(), ctx.Err())
+		case <-stop:
+			done <- nil
+		}
+	}()
+
+	return func() error {
+		close(stop)
+		return <-done
+	}
+}
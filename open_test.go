@@ -0,0 +1,75 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpen(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	c, err := Open(ctx, s.Addr, Password(testPassword))
+	cancel()
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	// The client outlives the context.
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	assert.NoError(t, c.Reset())
+}
+
+func TestOpenConnectRetry(t *testing.T) {
+	l, err := newLocalListener()
+	if !assert.NoError(t, err) {
+		return
+	}
+	// Nothing is listening, so every attempt fails.
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	start := time.Now()
+	_, err = Open(ctx, addr, WithConnectRetry(5, time.Millisecond*300))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Millisecond*250)
+}
+
+func TestOpenAuthTimeout(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	// Never reply to auth.
+	s.responses[fmt.Sprintf("%v:%v", auth, testPassword)] = []*pkt{}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+
+	start := time.Now()
+	_, err := Open(ctx, s.Addr, Password(testPassword), Timeout(time.Second*10))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second*2)
+}
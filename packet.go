@@ -7,6 +7,9 @@ import (
 )
 
 const (
+	// pktHeaderSize is the size of the packet size, ID and type fields.
+	pktHeaderSize = 12
+
 	// responseValue is the packet type returned in response to an execCommand.
 	responseValue = int32(0)
 
@@ -18,6 +21,10 @@ const (
 
 	// authResponse is the packet type which represents the connections current auth status.
 	authResponse = int32(2)
+
+	// maxEmptyReads is the number of consecutive reads returning no data and
+	// no error after which reading a packet fails with io.ErrNoProgress.
+	maxEmptyReads = 100
 )
 
 // pkt represents an rcon packet
@@ -26,6 +33,45 @@ type pkt struct {
 	ID   int32
 	Type int32
 	body []byte
+
+	// raw disables validation and stripping of the trailer when reading.
+	raw bool
+
+	// single writes only the body null terminator, omitting the empty string
+	// null terminator.
+	single bool
+
+	// lenient accepts empty packets without null terminators when reading.
+	lenient bool
+}
+
+// Packet types, for use with the low-level packet API.
+const (
+	// TypeResponseValue is the type of a response to a command.
+	TypeResponseValue = responseValue
+
+	// TypeExecCommand is the type of a command.
+	TypeExecCommand = execCommand
+
+	// TypeAuth is the type of an authentication request.
+	TypeAuth = auth
+
+	// TypeAuthResponse is the type of a response to an authentication request.
+	TypeAuthResponse = authResponse
+)
+
+// Response is a packet received from the server.
+type Response struct {
+	ID   int32
+	Type int32
+	Body string
+}
+
+// PacketView is a read only view of a received packet.
+type PacketView struct {
+	ID   int32
+	Type int32
+	Body []byte
 }
 
 // newPkt returns a new pkt for the given details.
@@ -33,13 +79,41 @@ func newPkt(t, id int32, body string) *pkt {
 	return &pkt{Type: t, Size: int32(len(body) + 10), ID: id, body: []byte(body)}
 }
 
+// newSinglePkt returns a new pkt for the given details which is written with
+// a single null terminator.
+func newSinglePkt(t, id int32, body string) *pkt {
+	return &pkt{Type: t, Size: int32(len(body) + 9), ID: id, body: []byte(body), single: true}
+}
+
+// trailer returns the null terminators written after the body.
+func (p *pkt) trailer() []byte {
+	if p.single {
+		return []byte{0x00}
+	}
+	return []byte{0x00, 0x00}
+}
+
 // Body returns the packet body as a string.
 func (p *pkt) Body() string {
 	return string(p.body)
 }
 
+// view returns a PacketView of the packet.
+func (p *pkt) view() PacketView {
+	return PacketView{ID: p.ID, Type: p.Type, Body: p.body}
+}
+
 // WriteTo implements io.WriterTo.
+// The packet is encoded in full before being written to w with a single call,
+// so if an error occurs n is the number of bytes of the packet which were
+// written before it, allowing callers to detect a partially written packet.
+// If the packet Size doesn't match its body it returns ErrPacketSize.
 func (p *pkt) WriteTo(w io.Writer) (n int64, err error) {
+	trailer := p.trailer()
+	if p.Size != int32(len(p.body)+8+len(trailer)) {
+		return 0, ErrPacketSize
+	}
+
 	buf := bytes.NewBuffer(make([]byte, 0, p.Size+4))
 
 	// Size of the packet not including the size field itself.
@@ -57,8 +131,8 @@ func (p *pkt) WriteTo(w io.Writer) (n int64, err error) {
 		return 0, err
 	}
 
-	// Body + null terminator + empty string null terminator
-	if _, err := buf.Write(append(p.body, 0x00, 0x00)); err != nil {
+	// Body + null terminator + empty string null terminator, unless single.
+	if _, err := buf.Write(append(p.body, trailer...)); err != nil {
 		return 0, err
 	}
 
@@ -66,38 +140,48 @@ func (p *pkt) WriteTo(w io.Writer) (n int64, err error) {
 }
 
 // ReadFrom implements io.ReaderFrom, reading a packet from r.
+// Packets must have a Size of at least 10, an empty body and its null
+// terminators, unless the packet is lenient in which case a Size of 8, an
+// empty body without null terminators, is also accepted.
+// ReadFrom doesn't apply any deadline itself, so if r is a connection the
+// caller must set one to prevent a stalled peer from blocking indefinitely.
+// The body is read using as many reads as required, so if r is buffered its
+// buffer size doesn't limit the size of the packet.
 func (p *pkt) ReadFrom(r io.Reader) (n int64, err error) {
-	if err = binary.Read(r, binary.LittleEndian, &p.Size); err != nil {
+	if n, err = p.readHeader(r); err != nil {
 		return n, err
 	}
-	n += 4
-	if p.Size < 10 {
-		return n, ErrMalformedResponse("size too small")
-	}
-
-	if err = binary.Read(r, binary.LittleEndian, &p.ID); err != nil {
-		return n, err
-	}
-	n += 4
-
-	if err = binary.Read(r, binary.LittleEndian, &p.Type); err != nil {
-		return n, err
-	}
-	n += 4
 
 	// We can't use ReadString(0x00) here as even though the spec says this
 	// should be null terminated string, said string can actually include null
 	// characters, which is the case in response to a responseValue packet.
-	var i int32
-	p.body = make([]byte, p.Size-8)
-	for i < p.Size-8 {
-		n2, err2 := r.Read(p.body[i:])
-		if err != nil {
-			return n + int64(n2) + int64(i), err2
+	// The body is grown as its read rather than allocated up front, so a bogus
+	// Size can't trigger a huge allocation.
+	size := int(p.Size - 8)
+	p.body = make([]byte, 0, minInt(size, maxPkt))
+	for empty := 0; len(p.body) < size; {
+		if len(p.body) == cap(p.body) {
+			p.body = append(p.body, 0)[:len(p.body)]
+		}
+
+		n2, err2 := r.Read(p.body[len(p.body):minInt(cap(p.body), size)])
+		p.body = p.body[:len(p.body)+n2]
+		if err2 != nil {
+			return n + int64(len(p.body)), err2
 		}
-		i += int32(n2)
+
+		// Guard against a misbehaving reader spinning the loop.
+		if empty++; n2 > 0 {
+			empty = 0
+		} else if empty >= maxEmptyReads {
+			return n + int64(len(p.body)), io.ErrNoProgress
+		}
+	}
+	n += int64(size)
+
+	if p.raw || p.lenient && size == 0 {
+		return n, nil
 	}
-	n += int64(i)
 
 	if !bytes.Equal(p.body[len(p.body)-2:], []byte{0x00, 0x00}) {
 		return n, ErrMalformedResponse("invalid trailer")
@@ -106,3 +190,103 @@ func (p *pkt) ReadFrom(r io.Reader) (n int64, err error) {
 
 	return n, nil
 }
+
+// readHeader reads the size, ID and type fields of the packet from r with a
+// single read, rather than one per field, to reduce the per packet overhead.
+// The count and error returned match those of reading each field in turn, so
+// only complete fields are counted and a field of which nothing was read
+// returns io.EOF.
+func (p *pkt) readHeader(r io.Reader) (n int64, err error) {
+	var hdr [pktHeaderSize]byte
+	read, err := io.ReadFull(r, hdr[:])
+	for i, f := range []*int32{&p.Size, &p.ID, &p.Type} {
+		if got := read - i*4; got < 4 {
+			if got == 0 && err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return n, err
+		}
+
+		*f = int32(binary.LittleEndian.Uint32(hdr[i*4:]))
+		n += 4
+		if i == 0 && p.Size < 10 && !(p.raw && p.Size >= 8 || p.lenient && p.Size == 8) {
+			return n, ErrMalformedResponse("size too small")
+		}
+	}
+
+	return n, nil
+}
+
+// Packet is a source rcon packet, for tooling which needs to encode or decode
+// packets directly.
+type Packet struct {
+	ID   int32
+	Type int32
+	Body []byte
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (p *Packet) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := newPkt(p.Type, p.ID, string(p.Body)).WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+// data must contain exactly one packet, whose trailing null terminators are
+// validated and stripped from Body.
+func (p *Packet) UnmarshalBinary(data []byte) error {
+	return p.unmarshal(data, false)
+}
+
+// UnmarshalBinaryRaw is like UnmarshalBinary except the trailing null
+// terminators aren't validated or stripped, so Body is exactly what the server
+// sent after the type field. This allows tooling to faithfully reproduce
+// packets from servers which don't follow the spec.
+func (p *Packet) UnmarshalBinaryRaw(data []byte) error {
+	return p.unmarshal(data, true)
+}
+
+// unmarshal decodes a single packet from data.
+func (p *Packet) unmarshal(data []byte, raw bool) error {
+	p2, n, err := parsePacket(data, raw)
+	if err != nil {
+		return err
+	} else if n != len(data) {
+		return ErrMalformedResponse("trailing data")
+	}
+
+	*p = *p2
+
+	return nil
+}
+
+// ParsePacket parses the packet at the start of data, returning it and the
+// number of bytes of data it used. Malformed input returns an error, either
+// ErrMalformedResponse or io.ErrUnexpectedEOF / io.EOF if data is truncated,
+// and never panics, making it suitable for fuzzing.
+func ParsePacket(data []byte) (*Packet, int, error) {
+	return parsePacket(data, false)
+}
+
+// parsePacket parses the packet at the start of data.
+func parsePacket(data []byte, raw bool) (*Packet, int, error) {
+	p := &pkt{raw: raw}
+	n, err := p.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		return nil, int(n), err
+	}
+
+	return &Packet{ID: p.ID, Type: p.Type, Body: p.body}, int(n), nil
+}
+
+// minInt returns the smaller of a and b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,312 @@
+package source
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// limitWriter is an io.Writer which accepts at most n bytes.
+type limitWriter struct {
+	n   int
+	err error
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if len(p) <= w.n {
+		w.n -= len(p)
+		return len(p), nil
+	}
+
+	n := w.n
+	w.n = 0
+	return n, w.err
+}
+
+// emptyReader is an io.Reader which returns no data and no error for empty
+// reads after the packet header, or all reads after it if empty is negative.
+type emptyReader struct {
+	r     io.Reader
+	read  int
+	empty int
+}
+
+func (r *emptyReader) Read(p []byte) (int, error) {
+	if r.read >= pktHeaderSize && r.empty != 0 {
+		r.empty--
+		return 0, nil
+	}
+
+	n, err := r.r.Read(p)
+	r.read += n
+	return n, err
+}
+
+func TestPktReadFromEmptyReads(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := newPkt(responseValue, 1, "status").WriteTo(&buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data := buf.Bytes()
+
+	p := &pkt{}
+	_, err = p.ReadFrom(&emptyReader{r: bytes.NewReader(data), empty: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, "status", p.Body())
+
+	p = &pkt{}
+	_, err = p.ReadFrom(&emptyReader{r: bytes.NewReader(data), empty: -1})
+	assert.Equal(t, io.ErrNoProgress, err)
+}
+
+func TestPktReadFromHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		expect int64
+		err    error
+	}{
+		{"empty", nil, 0, io.EOF},
+		{"partial-size", []byte{10, 0}, 0, io.ErrUnexpectedEOF},
+		{"size-only", []byte{10, 0, 0, 0}, 4, io.EOF},
+		{"partial-id", []byte{10, 0, 0, 0, 1}, 4, io.ErrUnexpectedEOF},
+		{"no-type", []byte{10, 0, 0, 0, 1, 0, 0, 0}, 8, io.EOF},
+		{"partial-type", []byte{10, 0, 0, 0, 1, 0, 0, 0, 2, 0}, 8, io.ErrUnexpectedEOF},
+		{"no-body", []byte{10, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0}, 12, io.EOF},
+		{"size-too-small", []byte{9, 0, 0, 0}, 4, ErrMalformedResponse("size too small")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			n, err := (&pkt{}).ReadFrom(bytes.NewReader(tc.data))
+			assert.Equal(t, tc.expect, n)
+			assert.Equal(t, tc.err, err)
+		})
+	}
+}
+
+// countingReader is an io.Reader which counts the reads made.
+type countingReader struct {
+	r     io.Reader
+	reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	return r.r.Read(p)
+}
+
+func BenchmarkPktReadFrom(b *testing.B) {
+	var buf bytes.Buffer
+	if _, err := newPkt(responseValue, 1, "hostname: My Server").WriteTo(&buf); err != nil {
+		b.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	br := bytes.NewReader(data)
+	r := &countingReader{r: br}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		br.Reset(data)
+		if _, err := (&pkt{}).ReadFrom(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(r.reads)/float64(b.N), "reads/op")
+}
+
+func TestPktWriteToPartial(t *testing.T) {
+	errShort := errors.New("short write")
+	p := newPkt(execCommand, 1, "status")
+	n, err := p.WriteTo(&limitWriter{n: 5, err: errShort})
+	assert.Equal(t, errShort, err)
+	assert.Equal(t, int64(5), n)
+
+	n, err = p.WriteTo(&limitWriter{n: 100})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(p.Size+4), n)
+}
+
+func TestPktWriteToSizeMismatch(t *testing.T) {
+	p := newPkt(execCommand, 1, "status")
+	p.Size++
+
+	var buf bytes.Buffer
+	n, err := p.WriteTo(&buf)
+	assert.Equal(t, ErrPacketSize, err)
+	assert.Equal(t, int64(0), n)
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestPacketBinary(t *testing.T) {
+	p := &Packet{ID: 7, Type: execCommand, Body: []byte("status")}
+	data, err := p.MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []byte{
+		0x10, 0x00, 0x00, 0x00,
+		0x07, 0x00, 0x00, 0x00,
+		0x02, 0x00, 0x00, 0x00,
+		's', 't', 'a', 't', 'u', 's', 0x00, 0x00,
+	}, data)
+
+	p2 := &Packet{}
+	if assert.NoError(t, p2.UnmarshalBinary(data)) {
+		assert.Equal(t, p, p2)
+	}
+
+	p2 = &Packet{}
+	if assert.NoError(t, p2.UnmarshalBinaryRaw(data)) {
+		assert.Equal(t, []byte("status\x00\x00"), p2.Body)
+	}
+
+	err = p2.UnmarshalBinary(append(data, 0x00))
+	assert.Equal(t, ErrMalformedResponse("trailing data"), err)
+}
+
+func TestPacketUnmarshalBinaryRaw(t *testing.T) {
+	// No trailer.
+	data := []byte{
+		0x0a, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		'h', 'i',
+	}
+
+	p := &Packet{}
+	assert.Equal(t, ErrMalformedResponse("invalid trailer"), p.UnmarshalBinary(data))
+
+	if assert.NoError(t, p.UnmarshalBinaryRaw(data)) {
+		assert.Equal(t, &Packet{ID: 1, Type: responseValue, Body: []byte("hi")}, p)
+	}
+
+	// Empty.
+	data = []byte{
+		0x08, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	assert.Equal(t, ErrMalformedResponse("size too small"), p.UnmarshalBinary(data))
+	if assert.NoError(t, p.UnmarshalBinaryRaw(data)) {
+		assert.Equal(t, &Packet{ID: 1, Type: responseValue, Body: []byte{}}, p)
+	}
+}
+
+func TestPktReadFromLenient(t *testing.T) {
+	size8 := []byte{
+		0x08, 0x00, 0x00, 0x00,
+		0x01, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	size10 := append(append([]byte{0x0a}, size8[1:]...), 0x00, 0x00)
+	size9 := append(append([]byte{0x09}, size8[1:]...), 0x00)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		lenient bool
+		err     error
+	}{
+		{"size-8", size8, false, ErrMalformedResponse("size too small")},
+		{"size-8-lenient", size8, true, nil},
+		{"size-9-lenient", size9, true, ErrMalformedResponse("size too small")},
+		{"size-10", size10, false, nil},
+		{"size-10-lenient", size10, true, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := &pkt{lenient: tc.lenient}
+			_, err := p.ReadFrom(bytes.NewReader(tc.data))
+			if tc.err != nil {
+				assert.Equal(t, tc.err, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, int32(1), p.ID)
+			assert.Empty(t, p.body)
+		})
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	data, err := (&Packet{ID: 1, Type: responseValue, Body: []byte("one")}).MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	n1 := len(data)
+	data2, err := (&Packet{ID: 2, Type: responseValue, Body: []byte("two")}).MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	data = append(data, data2...)
+
+	p, n, err := ParsePacket(data)
+	if assert.NoError(t, err) {
+		assert.Equal(t, n1, n)
+		assert.Equal(t, "one", string(p.Body))
+	}
+
+	p, _, err = ParsePacket(data[n:])
+	if assert.NoError(t, err) {
+		assert.Equal(t, "two", string(p.Body))
+	}
+
+	// Huge size, truncated body.
+	_, _, err = ParsePacket([]byte{
+		0xff, 0xff, 0xff, 0x7f,
+		0x01, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+		'x',
+	})
+	assert.Equal(t, io.EOF, err)
+}
+
+func FuzzReadFrom(f *testing.F) {
+	for _, p := range []*Packet{
+		{ID: 1, Type: responseValue},
+		{ID: 2, Type: execCommand, Body: []byte("status")},
+		{ID: -1, Type: authResponse, Body: responseBody},
+	} {
+		data, err := p.MarshalBinary()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{0x09, 0x00, 0x00, 0x00})
+	f.Add([]byte{0x08, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, raw := range []bool{false, true} {
+			p, n, err := parsePacket(data, raw)
+			if err != nil {
+				continue
+			}
+
+			if n > len(data) || len(p.Body) > n {
+				t.Fatalf("invalid length %v for %v bytes", n, len(data))
+			}
+
+			if raw {
+				continue
+			}
+
+			// Strict packets must round trip.
+			data2, err := p.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data[:n], data2) {
+				t.Fatalf("round trip mismatch %x != %x", data[:n], data2)
+			}
+		}
+	})
+}
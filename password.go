@@ -0,0 +1,74 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ChangePassword changes the rcon password of the server to pwd, using the
+// rcon_password command, then re-authenticates with it, as some servers drop
+// the authentication of the current connection when the password changes. If
+// the server closes the connection instead, the client reconnects using pwd.
+// On success pwd replaces the password(s) the client was configured with.
+//
+// The console has no escape sequences, so if pwd contains a double quote or
+// semicolon ErrInvalidPassword is returned without changing it.
+func (c *Client) ChangePassword(pwd string) error {
+	if c.dryRun {
+		return ErrDryRun
+	} else if strings.ContainsAny(pwd, `";`) {
+		return ErrInvalidPassword
+	}
+
+	cmd := NewCmd("rcon_password").WithArgs(Quote(pwd))
+	body, err := c.encode(cmd.String())
+	if err != nil {
+		return c.execErr(cmd.redacted(), err)
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	// The server may close the connection as it changes the password, in which
+	// case the client reconnects with pwd.
+	if _, err = c.execLocked(body); errors.Is(err, ErrPossiblyTruncated) {
+		err = nil
+	} else if err != nil && !connError(err) {
+		return c.execErr(cmd.redacted(), c.ctxErr(err))
+	}
+
+	c.pwd = pwd
+	c.pwds = nil
+	c.authErr = nil
+	if err == nil {
+		err = c.auth()
+	}
+	if err == nil {
+		return nil
+	} else if errors.Is(err, ErrAuthFailure) {
+		return fmt.Errorf("source: auth %v: %w", c.server(), err)
+	}
+
+	return c.reconnect()
+}
+
+// VerifyPassword connects to the server at addr and authenticates using pwd,
+// returning nil if it was accepted or an error matching ErrAuthFailure if it
+// was rejected. The connection is closed before VerifyPassword returns, so
+// it's suitable for validating credentials without managing a Client. An empty
+// pwd is never sent to the server, so is always rejected. Options are applied
+// as for NewClient, except passwords which are replaced by pwd.
+func VerifyPassword(addr, pwd string, options ...func(c *Client) error) error {
+	if pwd == "" {
+		return fmt.Errorf("source: auth %v: %w", addr, ErrAuthFailure)
+	}
+
+	opts := append(options[:len(options):len(options)], Password(pwd))
+	c, err := NewClient(addr, opts...)
+	if err != nil {
+		return err
+	}
+
+	return c.Close()
+}
@@ -0,0 +1,99 @@
+package source
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientChangePassword(t *testing.T) {
+	const newPassword = "new secret"
+
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:rcon_password %q", execCommand, newPassword)] = []*pkt{newPkt(responseValue, 0, "")}
+	s.responses[fmt.Sprintf("%v:%v", auth, newPassword)] = commands[fmt.Sprintf("%v:%v", auth, testPassword)]
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, WithPasswords("old", testPassword))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	if !assert.NoError(t, c.ChangePassword(newPassword)) {
+		return
+	}
+	assert.Equal(t, newPassword, c.pwd)
+	assert.Empty(t, c.pwds)
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	// The server doesn't accept the password.
+	err = c.ChangePassword("bad")
+	assert.ErrorIs(t, err, ErrAuthFailure)
+	assert.NotContains(t, err.Error(), `"bad"`)
+
+	assert.ErrorIs(t, c.ChangePassword(`bad"pwd`), ErrInvalidPassword)
+	assert.ErrorIs(t, c.ChangePassword("bad;quit"), ErrInvalidPassword)
+}
+
+func TestClientChangePasswordHangup(t *testing.T) {
+	const newPassword = "new secret"
+
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:rcon_password %q", execCommand, newPassword)] = []*pkt{nil}
+	s.responses[fmt.Sprintf("%v:%v", auth, newPassword)] = commands[fmt.Sprintf("%v:%v", auth, testPassword)]
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Password(testPassword))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	if !assert.NoError(t, c.ChangePassword(newPassword)) {
+		return
+	}
+	assert.Equal(t, newPassword, c.pwd)
+
+	resp, err := c.Exec("echo test me")
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
+
+func TestVerifyPassword(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	assert.NoError(t, VerifyPassword(s.Addr, testPassword, Timeout(time.Second*2)))
+	assert.ErrorIs(t, VerifyPassword(s.Addr, "wrong", Timeout(time.Second*2)), ErrAuthFailure)
+	assert.ErrorIs(t, VerifyPassword(s.Addr, "", Timeout(time.Second*2)), ErrAuthFailure)
+
+	// Passwords in the options are replaced.
+	assert.ErrorIs(t, VerifyPassword(s.Addr, "wrong", WithPasswords(testPassword)), ErrAuthFailure)
+}
@@ -0,0 +1,254 @@
+package source
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// pingWait is how long Ping waits for the server to close the connection.
+const pingWait = time.Millisecond
+
+// Ping checks the connection to the server is alive without sending anything,
+// by briefly waiting for the server to close or reset it. Any packet the server
+// has sent is left to be read by the next command. If the client uses a custom
+// Transport it returns ErrUnsupportedTransport.
+func (c *Client) Ping() error {
+	if !c.tcp() {
+		return ErrUnsupportedTransport
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.dryRun {
+		return ErrDryRun
+	} else if err := c.usable(); err != nil {
+		return err
+	}
+
+	_, err := c.waitPkt(pingWait)
+	return err
+}
+
+// PoolStats are the counters of a Pool.
+type PoolStats struct {
+	// Idle is the number of clients waiting in the pool.
+	Idle int
+
+	// Active is the number of clients returned by Get which haven't been
+	// returned to the pool.
+	Active int
+
+	// Dead is the number of idle clients evicted as their Ping failed.
+	Dead uint64
+}
+
+// Pool is a pool of clients connected to the same server, so a number of
+// connections can be reused by many goroutines. Idle clients are checked
+// periodically by a background reaper using Ping, and those which fail are
+// closed and replaced, so Get doesn't return clients whose connection has
+// been dropped by the server while idle. Clients which use a custom Transport
+// aren't checked, as Ping doesn't support them.
+type Pool struct {
+	addr     string
+	options  []func(c *Client) error
+	maxIdle  int
+	mtx      sync.Mutex
+	idle     []*Client
+	checking int
+	active   int
+	dead     uint64
+	closed   bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewPool returns a new Pool of clients connected to addr, created with
+// options as required. At most maxIdle clients are kept in the pool, and if
+// reapInterval is positive idle clients are checked every reapInterval.
+func NewPool(addr string, maxIdle int, reapInterval time.Duration, options ...func(c *Client) error) *Pool {
+	p := &Pool{
+		addr:    addr,
+		options: options,
+		maxIdle: maxIdle,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if reapInterval > 0 {
+		go p.reapLoop(reapInterval)
+	} else {
+		close(p.done)
+	}
+
+	return p
+}
+
+// Get returns an idle client from the pool, or a new one if there are none.
+// The client must be returned to the pool with Put when no longer required.
+func (p *Pool) Get() (*Client, error) {
+	p.mtx.Lock()
+	if p.closed {
+		p.mtx.Unlock()
+		return nil, ErrPoolClosed
+	}
+	p.active++
+	if n := len(p.idle); n > 0 {
+		c := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mtx.Unlock()
+		return c, nil
+	}
+	p.mtx.Unlock()
+
+	c, err := NewClient(p.addr, p.options...)
+	if err != nil {
+		p.mtx.Lock()
+		p.active--
+		p.mtx.Unlock()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Put returns c, which was returned by Get, to the pool. If c failed such that
+// its connection may be unusable, Reset or Close it first. If the pool is full
+// or closed c is closed.
+func (p *Pool) Put(c *Client) {
+	p.mtx.Lock()
+	p.active--
+	p.mtx.Unlock()
+
+	p.release(c)
+}
+
+// release adds c to the idle clients, or closes it if the pool is full or
+// closed.
+func (p *Pool) release(c *Client) {
+	p.mtx.Lock()
+	if !p.closed && len(p.idle) < p.maxIdle {
+		p.idle = append(p.idle, c)
+		c = nil
+	}
+	p.mtx.Unlock()
+
+	if c != nil {
+		c.Close() // nolint: errcheck
+	}
+}
+
+// Stats returns the counters of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	return PoolStats{Idle: len(p.idle) + p.checking, Active: p.active, Dead: p.dead}
+}
+
+// Close stops the reaper and closes the idle clients. Clients which are
+// active are closed when they're returned with Put.
+func (p *Pool) Close() error {
+	p.mtx.Lock()
+	if p.closed {
+		p.mtx.Unlock()
+		return nil
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mtx.Unlock()
+
+	close(p.stop)
+	<-p.done
+
+	var err error
+	for _, c := range idle {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
+
+// reapLoop checks the idle clients every interval until the pool is closed.
+func (p *Pool) reapLoop(interval time.Duration) {
+	defer close(p.done)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			p.reap()
+		}
+	}
+}
+
+// reap pings the idle clients one at a time, replacing those which fail, so
+// the others remain available to Get while each is checked.
+func (p *Pool) reap() {
+	p.mtx.Lock()
+	n := len(p.idle)
+	p.mtx.Unlock()
+
+	for i := 0; i < n; i++ {
+		c := p.checkout()
+		if c == nil {
+			return
+		}
+
+		if err := c.Ping(); err != nil && !errors.Is(err, ErrUnsupportedTransport) {
+			c.Close() // nolint: errcheck
+			c = p.replace()
+		}
+
+		p.mtx.Lock()
+		p.checking--
+		p.mtx.Unlock()
+
+		if c != nil {
+			p.release(c)
+		}
+	}
+}
+
+// checkout removes the longest idle client from the pool to be checked, or
+// returns nil if there are none or the pool is closed.
+func (p *Pool) checkout() *Client {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	n := len(p.idle)
+	if p.closed || n == 0 {
+		return nil
+	}
+
+	c := p.idle[0]
+	copy(p.idle, p.idle[1:])
+	p.idle[n-1] = nil
+	p.idle = p.idle[:n-1]
+	p.checking++
+
+	return c
+}
+
+// replace records the eviction of a dead client and returns a new client to
+// replace it, or nil if one couldn't be created.
+func (p *Pool) replace() *Client {
+	p.mtx.Lock()
+	p.dead++
+	p.mtx.Unlock()
+
+	c, err := NewClient(p.addr, p.options...)
+	if err != nil {
+		return nil
+	}
+
+	return c
+}
@@ -0,0 +1,161 @@
+package source
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// dropConns closes the server side of all connections to s.
+func (s *server) dropConns() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	for conn := range s.conns {
+		conn.Close() // nolint: errcheck
+		delete(s.conns, conn)
+	}
+}
+
+func TestPool(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	p := NewPool(s.Addr, 1, 0, Timeout(time.Second*2))
+
+	c1, err := p.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	c2, err := p.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, PoolStats{Active: 2}, p.Stats())
+
+	p.Put(c1)
+	p.Put(c2)
+	assert.Equal(t, PoolStats{Idle: 1}, p.Stats())
+
+	c, err := p.Get()
+	assert.NoError(t, err)
+	assert.True(t, c == c1)
+	p.Put(c)
+
+	assert.NoError(t, p.Close())
+	_, err = p.Get()
+	assert.ErrorIs(t, err, ErrPoolClosed)
+	assert.Equal(t, PoolStats{}, p.Stats())
+}
+
+func TestClientPing(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	assert.NoError(t, c.Ping())
+
+	resp, err := c.Exec("echo test me")
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	s.dropConns()
+	assert.Error(t, c.Ping())
+}
+
+func TestPoolReaperCustomTransport(t *testing.T) {
+	p := NewPool("unused", 1, time.Millisecond*10, WithTransport(&memTransport{}), Password(testPassword))
+	defer func() {
+		assert.NoError(t, p.Close())
+	}()
+
+	c, err := p.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.ErrorIs(t, c.Ping(), ErrUnsupportedTransport)
+	p.Put(c)
+
+	// Wait for a few sweeps, which don't evict the client.
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, PoolStats{Idle: 1}, p.Stats())
+
+	c2, err := p.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, c == c2)
+	p.Put(c2)
+}
+
+func TestPoolReaper(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	p := NewPool(s.Addr, 2, time.Millisecond*50, Timeout(time.Second*2))
+	defer func() {
+		assert.NoError(t, p.Close())
+	}()
+
+	c1, err := p.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	c2, err := p.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	// Ensure the server has accepted both connections.
+	for _, c := range []*Client{c1, c2} {
+		_, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+		assert.NoError(t, err)
+		p.Put(c)
+	}
+
+	s.dropConns()
+
+	deadline := time.Now().Add(time.Second * 5)
+	for p.Stats().Dead < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// Wait for the replacements to be returned to the pool.
+	for p.Stats().Idle < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(t, PoolStats{Idle: 2, Dead: 2}, p.Stats())
+
+	c, err := p.Get()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, c != c1 && c != c2)
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	p.Put(c)
+}
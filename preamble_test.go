@@ -0,0 +1,100 @@
+package source
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// routingProxy is a proxy which reads a routing line from each connection
+// before forwarding it to the server of that name.
+type routingProxy struct {
+	net.Listener
+	servers map[string]string
+}
+
+func (p *routingProxy) serve() {
+	for {
+		conn, err := p.Accept()
+		if err != nil {
+			return
+		}
+		go p.route(conn)
+	}
+}
+
+func (p *routingProxy) route(conn net.Conn) {
+	defer conn.Close() // nolint: errcheck
+
+	r := bufio.NewReader(conn)
+	name, err := r.ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	addr, ok := p.servers[name[:len(name)-1]]
+	if !ok {
+		return
+	}
+
+	backend, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer backend.Close() // nolint: errcheck
+
+	go io.Copy(backend, r) // nolint: errcheck
+	io.Copy(conn, backend) // nolint: errcheck
+}
+
+func TestClientWithPreamble(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	l, err := newLocalListener()
+	if !assert.NoError(t, err) {
+		return
+	}
+	p := &routingProxy{Listener: l, servers: map[string]string{"eu-1": s.Addr}}
+	go p.serve()
+	defer func() {
+		assert.NoError(t, p.Close())
+	}()
+
+	c, err := NewClient(l.Addr().String(), Timeout(time.Second*2), WithPreamble(func(conn net.Conn) error {
+		_, err := fmt.Fprintln(conn, "eu-1")
+		return err
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	errRoute := errors.New("no route")
+	_, err = NewClient(l.Addr().String(), WithPreamble(func(net.Conn) error {
+		return errRoute
+	}))
+	assert.ErrorIs(t, err, errRoute)
+
+	_, err = NewClient(s.Addr, WithTransport(&memTransport{}), WithPreamble(func(net.Conn) error {
+		return nil
+	}))
+	assert.ErrorIs(t, err, ErrUnsupportedTransport)
+}
@@ -0,0 +1,45 @@
+package source
+
+import (
+	"errors"
+	"io"
+	"syscall"
+)
+
+// probeCmd is the command executed by ProbeAuth.
+const probeCmd = "echo"
+
+// ProbeAuth connects to the server at addr without a password and executes a
+// trivial command, returning true if the command was rejected due to the lack
+// of authentication, indicating the server requires a password.
+//
+// Servers reject unauthenticated commands by closing the connection, so errors
+// which don't indicate that, such as a dial failure or timeout, are returned
+// as is. The probe connection is always closed before ProbeAuth returns.
+func ProbeAuth(addr string, options ...func(c *Client) error) (requiresPassword bool, err error) {
+	opts := append(options[:len(options):len(options)], Password(""))
+	c, err := NewClient(addr, opts...)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close() // nolint: errcheck
+
+	if _, err = c.Exec(probeCmd); err != nil {
+		if authRejected(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return false, nil
+}
+
+// authRejected returns true if err indicates the server rejected a command
+// due to the connection not being authenticated.
+func authRejected(err error) bool {
+	return errors.Is(err, ErrAuthFailure) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,47 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeAuth(t *testing.T) {
+	tests := []struct {
+		name        string
+		requireAuth bool
+	}{
+		{"no-password", false},
+		{"password", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerStopped(t)
+			if s == nil {
+				return
+			}
+			s.requireAuth = tc.requireAuth
+			s.Start()
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			required, err := ProbeAuth(s.Addr, Password(testPassword))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.requireAuth, required)
+		})
+	}
+}
+
+func TestProbeAuthDialFail(t *testing.T) {
+	l, err := newLocalListener()
+	if !assert.NoError(t, err) {
+		return
+	}
+	addr := l.Addr().String()
+	assert.NoError(t, l.Close())
+
+	_, err = ProbeAuth(addr)
+	assert.Error(t, err)
+}
@@ -0,0 +1,129 @@
+package source
+
+import (
+	"sync"
+)
+
+// queue is the ordered command queue used by Enqueue.
+type queue struct {
+	mtx    sync.Mutex
+	items  []queued
+	closed bool
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+// queued is a command waiting in the queue.
+type queued struct {
+	cmd *Cmd
+	res chan Result
+}
+
+// Enqueue appends cmd to the command queue of the client and returns a
+// channel which receives its Result once it's executed. Queued commands are
+// executed one at a time by ExecCmd, in the order they were enqueued, by a
+// worker started by the first call, so commands can be submitted from many
+// goroutines without blocking. The channel is buffered, so needn't be read.
+//
+// Close cancels the commands which haven't started, their results have an
+// error of ErrQueueClosed, as do those enqueued after it.
+func (c *Client) Enqueue(cmd *Cmd) <-chan Result {
+	res := make(chan Result, 1)
+
+	c.qmtx.Lock()
+	if c.queue == nil {
+		c.queue = &queue{wake: make(chan struct{}, 1), done: make(chan struct{})}
+		go c.queue.run(c)
+	}
+	q := c.queue
+	c.qmtx.Unlock()
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.closed {
+		res <- Result{Err: ErrQueueClosed}
+		return res
+	}
+
+	q.items = append(q.items, queued{cmd: cmd, res: res})
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return res
+}
+
+// run executes the queued commands until the queue is closed.
+func (q *queue) run(c *Client) {
+	defer close(q.done)
+
+	for {
+		item, ok := q.next()
+		if !ok {
+			return
+		}
+
+		resp, err := c.ExecCmd(item.cmd)
+		item.res <- Result{Response: resp, Err: err}
+	}
+}
+
+// next waits for and returns the next queued command, or false if the queue
+// is closed.
+func (q *queue) next() (queued, bool) {
+	for {
+		q.mtx.Lock()
+		if q.closed {
+			q.mtx.Unlock()
+			return queued{}, false
+		} else if len(q.items) > 0 {
+			item := q.items[0]
+			q.items = q.items[1:]
+			q.mtx.Unlock()
+			return item, true
+		}
+		q.mtx.Unlock()
+
+		<-q.wake
+	}
+}
+
+// close cancels the commands which haven't started and stops the worker.
+func (q *queue) close() {
+	q.mtx.Lock()
+	q.closed = true
+	for _, item := range q.items {
+		item.res <- Result{Err: ErrQueueClosed}
+	}
+	q.items = nil
+	q.mtx.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stopQueue closes the command queue, if started, returning a func which
+// waits for its worker to exit.
+func (c *Client) stopQueue() func() {
+	c.qmtx.Lock()
+	q := c.queue
+	if q == nil {
+		q = &queue{closed: true}
+		c.queue = q
+	}
+	c.qmtx.Unlock()
+
+	if q.done == nil {
+		// Never started.
+		return func() {}
+	}
+
+	q.close()
+	return func() {
+		<-q.done
+	}
+}
@@ -0,0 +1,89 @@
+package source
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientEnqueue(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	for i := 0; i < 10; i++ {
+		s.responses[fmt.Sprintf("%v:echo %v", execCommand, i)] = []*pkt{newPkt(responseValue, 0, fmt.Sprint(i))}
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Results are in submission order.
+	var results []<-chan Result
+	for i := 0; i < 10; i++ {
+		results = append(results, c.Enqueue(NewCmd("echo").WithArgs(i)))
+	}
+	for i, res := range results {
+		r := <-res
+		assert.NoError(t, r.Err)
+		assert.Equal(t, fmt.Sprint(i), r.Response)
+	}
+
+	// Safe for concurrent use.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := <-c.Enqueue(NewCmd("echo").WithArgs("test me"))
+			assert.NoError(t, r.Err)
+			assert.Equal(t, "test me", r.Response)
+		}()
+	}
+	wg.Wait()
+
+	assert.NoError(t, c.Close())
+	r := <-c.Enqueue(NewCmd("echo").WithArgs("test me"))
+	assert.ErrorIs(t, r.Err, ErrQueueClosed)
+}
+
+func TestClientEnqueueClose(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.delay = time.Millisecond * 100
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	first := c.Enqueue(NewCmd("echo").WithArgs("test me"))
+	var pending []<-chan Result
+	for i := 0; i < 5; i++ {
+		pending = append(pending, c.Enqueue(NewCmd("echo").WithArgs("test me")))
+	}
+
+	// Wait for the first to start.
+	time.Sleep(time.Millisecond * 50)
+	assert.NoError(t, c.Close())
+
+	<-first
+	for _, res := range pending {
+		assert.ErrorIs(t, (<-res).Err, ErrQueueClosed)
+	}
+}
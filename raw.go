@@ -0,0 +1,55 @@
+package source
+
+import (
+	"sync/atomic"
+)
+
+// SendRaw writes b to the connection as is, bypassing packet framing, and
+// returns the number of bytes written. It's bounded by the client timeout.
+//
+// SendRaw and ReadRaw are an advanced and unsafe escape hatch for probing how
+// servers react to malformed or non-standard frames. Nothing sent is
+// validated, and what's sent or read leaves the connection in an unknown
+// state, so the client should be Reset before other commands are executed.
+// If the client uses a custom Transport they return ErrUnsupportedTransport.
+func (c *Client) SendRaw(b []byte) (int, error) {
+	if c.dryRun {
+		return 0, ErrDryRun
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.tcp() {
+		return 0, ErrUnsupportedTransport
+	} else if err := c.setDeadline(); err != nil {
+		return 0, err
+	}
+
+	n, err := c.conn.Write(b)
+	atomic.AddUint64(&c.stats.BytesWritten, uint64(n))
+	return n, c.ctxErr(err)
+}
+
+// ReadRaw reads up to len(p) bytes received from the server into p as is,
+// bypassing packet framing, and returns the number of bytes read. It's bounded
+// by the client timeout. See SendRaw.
+func (c *Client) ReadRaw(p []byte) (int, error) {
+	if c.dryRun {
+		return 0, ErrDryRun
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if !c.tcp() {
+		return 0, ErrUnsupportedTransport
+	} else if err := c.setDeadline(); err != nil {
+		return 0, err
+	}
+
+	// Read through the reader so bytes it has buffered aren't skipped.
+	n, err := c.reader.Read(p)
+	atomic.AddUint64(&c.stats.BytesRead, uint64(n))
+	return n, c.ctxErr(err)
+}
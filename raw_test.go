@@ -0,0 +1,65 @@
+package source
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientSendReadRaw(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	var buf bytes.Buffer
+	_, err = newPkt(execCommand, 7, "echo test me").WriteTo(&buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	n, err := c.SendRaw(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, buf.Len(), n)
+
+	var expected bytes.Buffer
+	_, err = newPkt(responseValue, 7, "test me").WriteTo(&expected)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp := make([]byte, expected.Len())
+	_, err = io.ReadFull(readerFunc(c.ReadRaw), resp)
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Bytes(), resp)
+
+	c2, err := NewClient(s.Addr, WithTransport(&memTransport{}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = c2.SendRaw([]byte{0})
+	assert.ErrorIs(t, err, ErrUnsupportedTransport)
+	_, err = c2.ReadRaw(resp)
+	assert.ErrorIs(t, err, ErrUnsupportedTransport)
+}
+
+// readerFunc is an io.Reader which calls itself.
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
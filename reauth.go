@@ -0,0 +1,67 @@
+package source
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReauthInterval makes the client re-authenticate with the server every d,
+// keeping long lived sessions authenticated if the server invalidates them,
+// for example when an admin plugin reloads. Re-authentication waits for any
+// command in progress to complete. If it fails the client is considered
+// unauthenticated and subsequent commands return the error, which matches
+// ErrAuthFailure if the password was rejected, until the client is Reset.
+func ReauthInterval(d time.Duration) func(*Client) error {
+	return func(c *Client) error {
+		c.reauth = d
+		return nil
+	}
+}
+
+// startReauth starts re-authenticating periodically if enabled.
+func (c *Client) startReauth() {
+	if c.reauth <= 0 || c.dryRun {
+		return
+	}
+
+	c.reauthStop = make(chan struct{})
+	go c.reauthLoop(c.reauthStop)
+}
+
+// stopReauth stops re-authenticating, if started.
+func (c *Client) stopReauth() {
+	c.reauthOnce.Do(func() {
+		if c.reauthStop != nil {
+			close(c.reauthStop)
+		}
+	})
+}
+
+// reauthLoop re-authenticates every c.reauth until stop is closed.
+func (c *Client) reauthLoop(stop <-chan struct{}) {
+	t := time.NewTicker(c.reauth)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			c.reauthenticate()
+		}
+	}
+}
+
+// reauthenticate re-authenticates with the server, recording any error.
+func (c *Client) reauthenticate() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.authErr != nil {
+		return
+	}
+
+	if err := c.auth(); err != nil {
+		c.authErr = fmt.Errorf("source: reauth %v: %w", c.server(), c.ctxErr(err))
+	}
+}
@@ -0,0 +1,55 @@
+package source
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReauthInterval(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Password(testPassword), ReauthInterval(time.Millisecond*20))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	// Commands interleave with successful re-authentication.
+	for i := 0; i < 5; i++ {
+		resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+		assert.NoError(t, err)
+		assert.Equal(t, "test me", resp)
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// Simulate the password being changed on the server.
+	c.mtx.Lock()
+	c.pwd = "bad"
+	c.mtx.Unlock()
+	time.Sleep(time.Millisecond * 100)
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.ErrorIs(t, err, ErrAuthFailure)
+
+	// Reset restores the session.
+	c.mtx.Lock()
+	c.pwd = testPassword
+	c.mtx.Unlock()
+	if !assert.NoError(t, c.Reset()) {
+		return
+	}
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
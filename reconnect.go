@@ -0,0 +1,193 @@
+package source
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// minReconnectBackoff is the delay before the second attempt to
+	// reconnect, which doubles after each failure up to the maximum.
+	minReconnectBackoff = time.Millisecond * 100
+)
+
+var (
+	// DefaultMaxReconnectBackoff is the default maximum delay between attempts
+	// to reconnect made by a ReconnectingClient.
+	DefaultMaxReconnectBackoff = time.Second * 30
+)
+
+// Executor executes commands on a server. It's implemented by Client and
+// ReconnectingClient, so code can accept either.
+type Executor interface {
+	// Exec executes cmd on the server and returns the response.
+	Exec(cmd string) (string, error)
+
+	// ExecCmd executes cmd on the server and returns the response.
+	ExecCmd(cmd *Cmd) (string, error)
+}
+
+// ReconnectingClient is an Executor which wraps a Client, transparently
+// replacing it with a new one created with the same options whenever a command
+// fails due to a connection error, such as the server closing or resetting the
+// connection. The command is then retried once on the new Client, so commands
+// which aren't safe to repeat should be executed on a Client directly.
+//
+// Attempts to reconnect are made until one succeeds or Close is called, with
+// an exponential backoff between them. Timeouts aren't treated as connection
+// errors, as the server may just be slow.
+type ReconnectingClient struct {
+	addr        string
+	options     []func(c *Client) error
+	maxBackoff  time.Duration
+	onReconnect func(attempt int, err error)
+	mtx         sync.Mutex
+	c           *Client
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewReconnectingClient returns a new ReconnectingClient connected to addr,
+// using options for each Client it creates. maxBackoff limits the delay
+// between attempts to reconnect, if it's not positive
+// DefaultMaxReconnectBackoff is used. If onReconnect isn't nil it's called
+// after each attempt to reconnect with the attempt number, starting at 1, and
+// its error, which is nil if it succeeded, so callers can log or alert.
+//
+// The initial connection isn't retried, so errors such as a bad password are
+// returned immediately.
+func NewReconnectingClient(addr string, maxBackoff time.Duration, onReconnect func(attempt int, err error), options ...func(c *Client) error) (*ReconnectingClient, error) {
+	c, err := NewClient(addr, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxReconnectBackoff
+	}
+	if onReconnect == nil {
+		onReconnect = func(int, error) {}
+	}
+
+	return &ReconnectingClient{
+		addr:        addr,
+		options:     options,
+		maxBackoff:  maxBackoff,
+		onReconnect: onReconnect,
+		c:           c,
+		stop:        make(chan struct{}),
+	}, nil
+}
+
+// Exec creates a new Cmd from cmd and calls ExecCmd with it.
+func (r *ReconnectingClient) Exec(cmd string) (string, error) {
+	return r.ExecCmd(NewCmd(cmd))
+}
+
+// ExecCmd executes cmd on the server using the current Client, reconnecting
+// and retrying it once if it fails due to a connection error.
+func (r *ReconnectingClient) ExecCmd(cmd *Cmd) (string, error) {
+	c, err := r.client()
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.ExecCmd(cmd)
+	if err == nil || !connError(err) {
+		return resp, err
+	}
+
+	if c, err = r.reconnect(c); err != nil {
+		return "", err
+	}
+
+	return c.ExecCmd(cmd)
+}
+
+// Close closes the current Client, stopping any attempts to reconnect.
+func (r *ReconnectingClient) Close() error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.c == nil {
+		return nil
+	}
+	c := r.c
+	r.c = nil
+
+	return c.Close()
+}
+
+// client returns the current Client, or ErrClientClosed if r has been closed.
+func (r *ReconnectingClient) client() (*Client, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.c == nil {
+		return nil, ErrClientClosed
+	}
+
+	return r.c, nil
+}
+
+// reconnect replaces failed with a new Client, retrying with backoff until it
+// succeeds or r is closed. If failed has already been replaced, such as by a
+// concurrent command, its replacement is returned.
+func (r *ReconnectingClient) reconnect(failed *Client) (*Client, error) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.c == nil {
+		return nil, ErrClientClosed
+	} else if r.c != failed {
+		return r.c, nil
+	}
+	failed.Close() // nolint: errcheck
+
+	backoff := minReconnectBackoff
+	for attempt := 1; ; attempt++ {
+		c, err := NewClient(r.addr, r.options...)
+		r.onReconnect(attempt, err)
+		if err == nil {
+			r.c = c
+			return c, nil
+		}
+
+		select {
+		case <-r.stop:
+			r.c = nil
+			return nil, ErrClientClosed
+		case <-time.After(backoff):
+		}
+
+		if backoff *= 2; backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+}
+
+// connError returns true if err indicates the connection to the server has
+// failed, so it must be replaced.
+func connError(err error) bool {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, net.ErrClosed),
+		errors.Is(err, ErrConnPoisoned):
+		return true
+	case errors.As(err, &netErr):
+		return !netErr.Timeout()
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package source
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ Executor = (*Client)(nil)
+	_ Executor = (*ReconnectingClient)(nil)
+)
+
+func TestReconnectingClient(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var attempts []int
+	onReconnect := func(attempt int, err error) {
+		assert.NoError(t, err)
+		attempts = append(attempts, attempt)
+	}
+
+	r, err := NewReconnectingClient(s.Addr, time.Second, onReconnect, Timeout(time.Second*2), Password(testPassword))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err := r.Exec("echo test me")
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	s.dropConns()
+
+	resp, err = r.Exec("echo test me")
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	assert.Equal(t, []int{1}, attempts)
+
+	assert.NoError(t, r.Close())
+	_, err = r.Exec("echo test me")
+	assert.ErrorIs(t, err, ErrClientClosed)
+}
+
+func TestReconnectingClientCloseWhileReconnecting(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+
+	failed := make(chan struct{}, 10)
+	onReconnect := func(attempt int, err error) {
+		assert.Error(t, err)
+		failed <- struct{}{}
+	}
+
+	r, err := NewReconnectingClient(s.Addr, time.Millisecond*100, onReconnect, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Wait for the server to accept the connection before closing it.
+	_, err = r.Exec("echo test me")
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Exec("echo test me")
+		done <- err
+	}()
+
+	<-failed
+	assert.NoError(t, r.Close())
+	assert.ErrorIs(t, <-done, ErrClientClosed)
+}
+
+func TestReconnectingClientNonConnError(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	r, err := NewReconnectingClient(s.Addr, 0, func(int, error) {
+		t.Error("unexpected reconnect")
+	}, Timeout(time.Second*2))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, r.Close())
+	}()
+
+	_, err = r.Exec("say é")
+	assert.ErrorIs(t, err, ErrNonASCII)
+}
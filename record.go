@@ -0,0 +1,160 @@
+package source
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Recording frame directions.
+const (
+	// recordSent marks a frame of bytes sent to the server.
+	recordSent = byte('S')
+
+	// recordReceived marks a frame of bytes received from the server.
+	recordReceived = byte('R')
+)
+
+// recorder writes the frames of a recording to w.
+// Each frame is a direction byte, the little endian uint32 length of the data
+// and the data itself.
+type recorder struct {
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+// recordWriter is an io.Writer which records frames in one direction.
+type recordWriter struct {
+	r   *recorder
+	dir byte
+}
+
+// RecordTo records the exact bytes exchanged with the server to w, in a form
+// which ReplayTransport can play back, so the behaviour of a server can be
+// captured once and tested against without it. Errors writing to w are
+// ignored.
+func RecordTo(w io.Writer) func(*Client) error {
+	return func(c *Client) error {
+		c.record = &recorder{w: w}
+		return nil
+	}
+}
+
+// Write implements io.Writer.
+func (rw recordWriter) Write(b []byte) (int, error) {
+	rw.r.mtx.Lock()
+	defer rw.r.mtx.Unlock()
+
+	hdr := make([]byte, 5)
+	hdr[0] = rw.dir
+	binary.LittleEndian.PutUint32(hdr[1:], uint32(len(b)))
+	if _, err := rw.r.w.Write(append(hdr, b...)); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// wrap returns conn wrapped so its traffic is recorded.
+func (r *recorder) wrap(c *Client) {
+	c.conn = &tapConn{
+		Conn:     c.conn,
+		sent:     recordWriter{r: r, dir: recordSent},
+		received: recordWriter{r: r, dir: recordReceived},
+	}
+}
+
+// replayTransport is a Transport which plays back a recording.
+type replayTransport struct {
+	r        io.Reader
+	once     sync.Once
+	err      error
+	sent     *bytes.Reader
+	received *bytes.Reader
+}
+
+// ReplayTransport returns a Transport which plays back the recording made by
+// RecordTo read from r, for use with WithTransport. Packets read are those
+// received from the server in the recording. Packets written are checked
+// against those sent in the recording, returning ErrReplayMismatch if they
+// differ, so the client must be configured as it was when recording.
+func ReplayTransport(r io.Reader) Transport {
+	return &replayTransport{r: r}
+}
+
+// load reads and splits the recording into the sent and received streams.
+func (rt *replayTransport) load() error {
+	rt.once.Do(func() {
+		var data []byte
+		if data, rt.err = ioutil.ReadAll(rt.r); rt.err != nil {
+			return
+		}
+
+		var sent, received bytes.Buffer
+		for len(data) > 0 {
+			if len(data) < 5 {
+				rt.err = ErrMalformedResponse("truncated recording")
+				return
+			}
+			n := int(binary.LittleEndian.Uint32(data[1:5]))
+			if len(data)-5 < n {
+				rt.err = ErrMalformedResponse("truncated recording")
+				return
+			}
+
+			if data[0] == recordSent {
+				sent.Write(data[5 : 5+n]) // nolint: errcheck
+			} else {
+				received.Write(data[5 : 5+n]) // nolint: errcheck
+			}
+			data = data[5+n:]
+		}
+
+		rt.sent = bytes.NewReader(sent.Bytes())
+		rt.received = bytes.NewReader(received.Bytes())
+	})
+
+	return rt.err
+}
+
+// ReadPacket implements Transport.
+func (rt *replayTransport) ReadPacket() (*Packet, error) {
+	if err := rt.load(); err != nil {
+		return nil, err
+	}
+
+	p := &pkt{}
+	if _, err := p.ReadFrom(rt.received); err != nil {
+		return nil, err
+	}
+
+	return &Packet{ID: p.ID, Type: p.Type, Body: p.body}, nil
+}
+
+// WritePacket implements Transport.
+func (rt *replayTransport) WritePacket(p *Packet) error {
+	if err := rt.load(); err != nil {
+		return err
+	}
+
+	// Parsed raw so packets recorded with SingleNullTerminator also match.
+	expected := &pkt{raw: true}
+	if _, err := expected.ReadFrom(rt.sent); err != nil {
+		return ErrReplayMismatch
+	}
+
+	body := append(p.Body, 0x00)
+	if expected.ID != p.ID || expected.Type != p.Type ||
+		!(bytes.Equal(expected.body, body) || bytes.Equal(expected.body, append(body, 0x00))) {
+		return ErrReplayMismatch
+	}
+
+	return nil
+}
+
+// Close implements Transport.
+func (rt *replayTransport) Close() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package source
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var rec bytes.Buffer
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), RecordTo(&rec))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	assert.NoError(t, c.Close())
+	assert.NotEmpty(t, rec.Bytes())
+
+	// Replaying the same exchange gives the same response.
+	c, err = NewClient(s.Addr, WithTransport(ReplayTransport(bytes.NewReader(rec.Bytes()))))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	resp, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	assert.NoError(t, c.Close())
+
+	// A different command doesn't match the recording.
+	c, err = NewClient(s.Addr, WithTransport(ReplayTransport(bytes.NewReader(rec.Bytes()))))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("other"))
+	assert.ErrorIs(t, err, ErrReplayMismatch)
+	assert.NoError(t, c.Close())
+
+	// A truncated recording is reported.
+	c, err = NewClient(s.Addr, WithTransport(ReplayTransport(bytes.NewReader(rec.Bytes()[:3]))))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.Error(t, err)
+	assert.NoError(t, c.Close())
+}
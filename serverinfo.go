@@ -0,0 +1,177 @@
+package source
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statusMaxPlayers matches the maximum number of players in the players line
+// of the output of the Source status command, such as "(20/0 max)" or the
+// older "(24 max)".
+var statusMaxPlayers = regexp.MustCompile(`\((\d+)(?:/\d+)? max\)`)
+
+// ServerInfo is information about the state of a server, similar to that
+// returned by an A2S_INFO query. Fields which the server flavour doesn't
+// report are left as their zero value.
+type ServerInfo struct {
+	// Hostname is the name of the server.
+	Hostname string
+
+	// Map is the name of the current map.
+	Map string
+
+	// Players is the number of players online.
+	Players int
+
+	// MaxPlayers is the maximum number of players.
+	MaxPlayers int
+
+	// Uptime is how long the server has been running.
+	Uptime time.Duration
+
+	// FPS is the number of frames the server processes per second.
+	FPS float64
+
+	// CPU is the CPU usage of the server, as reported by it.
+	CPU float64
+}
+
+// ServerInfo returns information about the state of the server, gathered over
+// the RCON connection by executing and parsing the commands of the server
+// flavour, such as stats and status for Source servers and list for Minecraft,
+// avoiding the need for a separate A2S query. If no flavour is configured or
+// detected the server is assumed to be Source based. If the flavour doesn't
+// support it it returns ErrUnsupportedByFlavour, and if the server reports a
+// command as unknown it returns ErrCommandNotSupported.
+func (c *Client) ServerInfo() (*ServerInfo, error) {
+	f := c.currentFlavour()
+	if f.serverInfo == nil {
+		return nil, ErrUnsupportedByFlavour
+	}
+
+	return f.serverInfo(c, f)
+}
+
+// sourceServerInfo returns the server info of a Source server from the output
+// of its stats and status commands.
+func sourceServerInfo(c *Client, f flavour) (*ServerInfo, error) {
+	stats, err := c.execFlavourCmd(f, NewCmd("stats"))
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := c.execFlavourCmd(f, NewCmd("status"))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ServerInfo{}
+	if err = parseStats(stats, info); err != nil {
+		return nil, err
+	}
+	parseStatus(status, info)
+
+	return info, nil
+}
+
+// parseStats sets the fields of info from the output of the Source stats
+// command, a row of column headers followed by a row of values, such as:
+//
+//	CPU    In_(KB/s)  Out_(KB/s)  Uptime  Map_changes  FPS      Players  Connects
+//	0.00   0.00       0.00        6       0            66.67    0        0
+//
+// Uptime is reported in minutes.
+func parseStats(resp string, info *ServerInfo) error {
+	lines := strings.Split(strings.TrimSpace(resp), "\n")
+	for i, line := range lines[:len(lines)-1] {
+		headers := strings.Fields(line)
+		if len(headers) == 0 || !strings.EqualFold(headers[0], "cpu") {
+			continue
+		}
+
+		values := strings.Fields(lines[i+1])
+		if len(values) != len(headers) {
+			return ErrMalformedResponse("stats columns mismatch")
+		}
+
+		for j, h := range headers {
+			if err := setStat(info, strings.ToLower(h), values[j]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return ErrMalformedResponse("unrecognised stats")
+}
+
+// setStat sets the field of info for the stats column named header to value.
+func setStat(info *ServerInfo, header, value string) error {
+	var err error
+	switch header {
+	case "cpu":
+		info.CPU, err = strconv.ParseFloat(value, 64)
+	case "fps":
+		info.FPS, err = strconv.ParseFloat(value, 64)
+	case "players":
+		info.Players, err = strconv.Atoi(value)
+	case "uptime":
+		var mins int
+		mins, err = strconv.Atoi(value)
+		info.Uptime = time.Duration(mins) * time.Minute
+	}
+	if err != nil {
+		return ErrMalformedResponse("invalid stats " + header)
+	}
+
+	return nil
+}
+
+// parseStatus sets the fields of info from the "key : value" lines of the
+// output of the Source status command, such as:
+//
+//	hostname: My Server
+//	map     : de_dust2 at: 0 x, 0 y, 0 z
+//	players : 3 humans, 0 bots (20/0 max) (not hibernating)
+//
+// Lines which aren't recognised are ignored.
+func parseStatus(resp string, info *ServerInfo) {
+	for _, line := range strings.Split(resp, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "hostname":
+			info.Hostname = value
+		case "map":
+			if fields := strings.Fields(value); len(fields) > 0 {
+				info.Map = fields[0]
+			}
+		case "players":
+			if m := statusMaxPlayers.FindStringSubmatch(value); m != nil {
+				info.MaxPlayers, _ = strconv.Atoi(m[1])
+			}
+		}
+	}
+}
+
+// minecraftServerInfo returns the server info of a Minecraft server from the
+// output of its list command.
+func minecraftServerInfo(c *Client, f flavour) (*ServerInfo, error) {
+	resp, err := c.execFlavourCmd(f, NewCmd("list"))
+	if err != nil {
+		return nil, err
+	}
+
+	online, max, _, err := ParseMinecraftList(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ServerInfo{Players: online, MaxPlayers: max}, nil
+}
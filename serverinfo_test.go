@@ -0,0 +1,127 @@
+package source
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientServerInfo(t *testing.T) {
+	tests := []struct {
+		name      string
+		flavour   string
+		responses map[string]string
+		expect    *ServerInfo
+		err       error
+	}{
+		{
+			name: "source",
+			responses: map[string]string{
+				"stats": "CPU    In_(KB/s)  Out_(KB/s)  Uptime  Map_changes  FPS      Players  Connects\n" +
+					"12.50  1.20       3.40        90      2            66.67    3        10\n",
+				"status": "hostname: My Server\n" +
+					"version : 1.38.7.9/13879 1575/8965 secure  [G:1:4031138]\n" +
+					"map     : de_dust2 at: 0 x, 0 y, 0 z\n" +
+					"players : 3 humans, 0 bots (20/0 max) (not hibernating)\n",
+			},
+			expect: &ServerInfo{
+				Hostname:   "My Server",
+				Map:        "de_dust2",
+				Players:    3,
+				MaxPlayers: 20,
+				Uptime:     time.Minute * 90,
+				FPS:        66.67,
+				CPU:        12.5,
+			},
+		},
+		{
+			name: "source-old",
+			responses: map[string]string{
+				"stats":  "CPU   In    Out   Uptime  Users   FPS    Players\n 0.00  0.00  0.00       5     0  62.98        1\n",
+				"status": "hostname: Old Server\nmap     : cp_well at: 0 x, 0 y, 0 z\nplayers : 1 (24 max)\n",
+			},
+			expect: &ServerInfo{
+				Hostname:   "Old Server",
+				Map:        "cp_well",
+				Players:    1,
+				MaxPlayers: 24,
+				Uptime:     time.Minute * 5,
+				FPS:        62.98,
+			},
+		},
+		{
+			name: "source-malformed",
+			responses: map[string]string{
+				"stats":  "garbage",
+				"status": "hostname: My Server\n",
+			},
+			err: ErrMalformedResponse("unrecognised stats"),
+		},
+		{
+			name: "source-unsupported",
+			responses: map[string]string{
+				"stats": "Unknown command \"stats\"",
+			},
+			err: ErrCommandNotSupported("stats"),
+		},
+		{
+			name:    "minecraft-unsupported",
+			flavour: "minecraft",
+			responses: map[string]string{
+				"list": "Unknown or incomplete command, see below for error",
+			},
+			err: ErrCommandNotSupported("list"),
+		},
+		{
+			name:    "minecraft",
+			flavour: "minecraft",
+			responses: map[string]string{
+				"list": "There are 2 of a max of 10 players online: Alice, Bob",
+			},
+			expect: &ServerInfo{Players: 2, MaxPlayers: 10},
+		},
+		{
+			name:    "starbound",
+			flavour: "starbound",
+			err:     ErrUnsupportedByFlavour,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerStopped(t)
+			if s == nil {
+				return
+			}
+			for cmd, resp := range tc.responses {
+				s.responses[fmt.Sprintf("%v:%v", execCommand, cmd)] = []*pkt{newPkt(responseValue, 0, resp)}
+			}
+			s.Start()
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			opts := []func(*Client) error{Timeout(time.Second * 2), DisableMultiPacket()}
+			if tc.flavour != "" {
+				opts = append(opts, Flavour(tc.flavour))
+			}
+			c, err := NewClient(s.Addr, opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			info, err := c.ServerInfo()
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, info)
+		})
+	}
+}
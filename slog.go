@@ -0,0 +1,104 @@
+package source
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// WithSlog sets a structured logger which is sent records of connections,
+// commands and recoverable protocol issues, with attributes such as label,
+// addr, cmd, request_id, bytes, duration and error. Successful operations are
+// logged at debug level and failures at warn level. Commands which set a
+// password have their arguments redacted. It's independent of WithLogger. By
+// default nothing is logged.
+func WithSlog(l *slog.Logger) func(*Client) error {
+	return func(c *Client) error {
+		c.slog = l
+		return nil
+	}
+}
+
+// logConnect logs the result of a connection attempt started at start.
+func (c *Client) logConnect(start time.Time, err error) {
+	if c.slog == nil {
+		return
+	}
+
+	attrs := []slog.Attr{
+		c.labelAttr(),
+		slog.String("addr", c.addr),
+		slog.Duration("duration", c.now().Sub(start)),
+	}
+	if err != nil {
+		c.slog.LogAttrs(context.Background(), slog.LevelWarn, "source: connect failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+
+	c.slog.LogAttrs(context.Background(), slog.LevelDebug, "source: connected", attrs...)
+}
+
+// logCommand returns onChunk wrapped to count the bytes of the response to
+// body, sent with request id, and a func which logs the command when called
+// with its result.
+func (c *Client) logCommand(id int32, body string, onChunk func(body []byte) error) (func(body []byte) error, func(err error)) {
+	if c.slog == nil {
+		return onChunk, func(error) {}
+	}
+
+	start, n := c.now(), 0
+	counter := func(b []byte) error {
+		n += len(b)
+		return onChunk(b)
+	}
+
+	return counter, func(err error) {
+		attrs := []slog.Attr{
+			c.labelAttr(),
+			slog.String("addr", c.addr),
+			slog.String("cmd", redactBody(body)),
+			slog.Int64("request_id", int64(id)),
+			slog.Int("bytes", n),
+			slog.Duration("duration", c.now().Sub(start)),
+		}
+		if err != nil {
+			c.slog.LogAttrs(context.Background(), slog.LevelWarn, "source: command failed", append(attrs, slog.Any("error", err))...)
+			return
+		}
+
+		c.slog.LogAttrs(context.Background(), slog.LevelDebug, "source: command", attrs...)
+	}
+}
+
+// logUnexpected logs that the packet p with an unexpected ID was ignored.
+func (c *Client) logUnexpected(p *pkt) {
+	if c.slog == nil {
+		return
+	}
+
+	c.slog.LogAttrs(context.Background(), slog.LevelWarn, "source: ignoring packet with unexpected id",
+		c.labelAttr(),
+		slog.String("addr", c.addr),
+		slog.Int64("request_id", int64(p.ID)),
+	)
+}
+
+// labelAttr returns the label attribute, which is empty and so omitted by
+// handlers if no label is set.
+func (c *Client) labelAttr() slog.Attr {
+	if c.label == "" {
+		return slog.Attr{}
+	}
+	return slog.String("label", c.label)
+}
+
+// redactBody returns the command body with the arguments replaced if the
+// command sets a password, like Cmd.redacted.
+func redactBody(body string) string {
+	name := strings.SplitN(body, " ", 2)
+	if len(name) == 2 && strings.Contains(strings.ToLower(name[0]), "password") {
+		return name[0] + " <redacted>"
+	}
+	return body
+}
@@ -0,0 +1,80 @@
+package source
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientWithSlog(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithSlog(l), WithMaxCommandSize(20))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+	assert.Contains(t, buf.String(), `level=DEBUG msg="source: connected" addr=`+s.Addr)
+
+	buf.Reset()
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+	assert.Contains(t, buf.String(), `level=DEBUG msg="source: command" addr=`+s.Addr+` cmd="echo test me" request_id=0 bytes=7 duration=`)
+
+	buf.Reset()
+	_, err = c.ExecCmd(NewCmd("rcon_password").WithArgs("a very long secret"))
+	assert.ErrorIs(t, err, ErrCommandTooLarge)
+	assert.Contains(t, buf.String(), `level=WARN msg="source: command failed" addr=`+s.Addr+` cmd="rcon_password <redacted>"`)
+	assert.Contains(t, buf.String(), `error="source: command too large"`)
+	assert.NotContains(t, buf.String(), "secret")
+}
+
+func TestRedactBody(t *testing.T) {
+	assert.Equal(t, "status", redactBody("status"))
+	assert.Equal(t, "kick 3", redactBody("kick 3"))
+	assert.Equal(t, "rcon_password <redacted>", redactBody("rcon_password secret"))
+	assert.Equal(t, "sv_password", redactBody("sv_password"))
+}
+
+func TestClientWithLabel(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), WithSlog(l), WithLabel("eu-1"), WithMaxCommandSize(10))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	assert.Equal(t, "eu-1", c.Label())
+	assert.Contains(t, buf.String(), `msg="source: connected" label=eu-1 addr=`+s.Addr)
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("too long"))
+	assert.EqualError(t, err, `source: eu-1: exec "echo too long": source: command too large`)
+
+	_, err = NewClient(s.Addr, WithLabel("eu-1"), Password("wrong"))
+	assert.EqualError(t, err, "source: auth eu-1 ("+s.Addr+"): source: authentication failure: got id=-1 type=2")
+}
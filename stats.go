@@ -0,0 +1,38 @@
+package source
+
+import (
+	"sync/atomic"
+)
+
+// Stats are the cumulative counters of a Client since it was created.
+type Stats struct {
+	// BytesRead is the number of bytes of packets read from the server.
+	BytesRead uint64
+
+	// BytesWritten is the number of bytes of packets written to the server.
+	BytesWritten uint64
+
+	// CommandsExecuted is the number of commands executed.
+	CommandsExecuted uint64
+
+	// Errors is the number of commands which failed.
+	Errors uint64
+}
+
+// Stats returns the cumulative counters of the client.
+func (c *Client) Stats() Stats {
+	return Stats{
+		BytesRead:        atomic.LoadUint64(&c.stats.BytesRead),
+		BytesWritten:     atomic.LoadUint64(&c.stats.BytesWritten),
+		CommandsExecuted: atomic.LoadUint64(&c.stats.CommandsExecuted),
+		Errors:           atomic.LoadUint64(&c.stats.Errors),
+	}
+}
+
+// countCommand counts a command which resulted in err.
+func (c *Client) countCommand(err error) {
+	atomic.AddUint64(&c.stats.CommandsExecuted, 1)
+	if err != nil {
+		atomic.AddUint64(&c.stats.Errors, 1)
+	}
+}
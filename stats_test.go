@@ -0,0 +1,41 @@
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientStats(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Password(testPassword), WithMaxCommandSize(20))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	// Auth packet and its two replies.
+	assert.Equal(t, Stats{BytesRead: 28, BytesWritten: 20}, c.Stats())
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+
+	_, err = c.ExecCmd(NewCmd("echo").WithArgs("this command is too large"))
+	assert.ErrorIs(t, err, ErrCommandTooLarge)
+
+	assert.Equal(t, Stats{
+		BytesRead:        28 + 21 + 14 + 18,
+		BytesWritten:     20 + 26 + 14,
+		CommandsExecuted: 2,
+		Errors:           1,
+	}, c.Stats())
+}
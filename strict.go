@@ -0,0 +1,114 @@
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// strictTrailingWait is the time StrictProtocol waits after the terminators of
+// a response for any extra packets.
+const strictTrailingWait = time.Millisecond * 50
+
+// StrictProtocol makes the client validate that multi-packet responses follow
+// the protocol exactly, for developers testing the conformance of their
+// server implementation: packets must be of type responseValue, the packets of
+// the response must all have the ID of the command and precede the two
+// terminator packets which have the following ID, the first with an empty
+// body and the second with the body 0x00000100, and nothing may follow them.
+// Any deviation, including a packet with any other ID, fails the command with
+// an ErrMalformedResponse detailing it, so WithUnexpectedIDTolerance,
+// WithUnsolicitedHandler and the terminator matcher don't apply.
+//
+// To detect extra packets each response waits briefly after its terminators,
+// so commands take longer, and the pipelined responses of ExecBatch are
+// reported as extra packets. Extra packets aren't detected with custom
+// transports. Single-packet mode isn't affected, see DisableMultiPacket.
+func StrictProtocol() func(*Client) error {
+	return func(c *Client) error {
+		c.strict = true
+		c.setMultiPacket(c.multi)
+		return nil
+	}
+}
+
+// readStrict reads a multi-packet response like readMulti, failing on any
+// deviation from the protocol, see StrictProtocol.
+func (c *Client) readStrict(expectedID int32, onChunk func(body []byte) error) error {
+	var terminated bool
+	for i := 1; ; i++ {
+		p, err := c.readPkt()
+		if err != nil {
+			return err
+		}
+
+		if p.ID == expectedID {
+			if err = strictResponse(i, p, terminated); err != nil {
+				return err
+			} else if err = onChunk(p.body); err != nil {
+				return err
+			}
+			continue
+		}
+
+		done, err := strictTerminator(i, p, expectedID+1, terminated)
+		if err != nil || done {
+			return c.strictTrailing(i, err)
+		}
+		terminated = true
+	}
+}
+
+// strictResponse validates the nth packet of a response, which has the ID of
+// the command, returning an error if it's invalid.
+func strictResponse(n int, p *pkt, terminated bool) error {
+	switch {
+	case p.Type != responseValue:
+		return strictErr(n, "type %v, expected %v", p.Type, responseValue)
+	case terminated:
+		return strictErr(n, "response id %v after terminator", p.ID)
+	}
+
+	return nil
+}
+
+// strictTerminator validates the nth packet of a response, which should be a
+// terminator with id, returning true if it's the second terminator and an
+// error if it's invalid.
+func strictTerminator(n int, p *pkt, id int32, terminated bool) (bool, error) {
+	switch {
+	case p.ID != id:
+		return false, strictErr(n, "id %v, expected %v or %v", p.ID, id-1, id)
+	case p.Type != responseValue:
+		return false, strictErr(n, "type %v, expected %v", p.Type, responseValue)
+	case !terminated && len(p.body) != 0:
+		return false, strictErr(n, "terminator body %q, expected empty", p.body)
+	case terminated && !bytes.Equal(p.body, responseBody):
+		return false, strictErr(n, "terminator body %q, expected %q", p.body, responseBody)
+	}
+
+	return terminated, nil
+}
+
+// strictTrailing returns err if not nil, otherwise it waits briefly for any
+// packet following the nth packet, the last of a response, returning an error
+// if one arrives.
+func (c *Client) strictTrailing(n int, err error) error {
+	if err != nil || !c.tcp() {
+		return err
+	}
+
+	// A failure of the connection isn't an extra packet, and will be reported
+	// by the next command.
+	if ok, _ := c.waitPkt(strictTrailingWait); ok {
+		return strictErr(n+1, "unexpected packet after terminator")
+	}
+
+	return nil
+}
+
+// strictErr returns an ErrMalformedResponse detailing a deviation from the
+// protocol by the nth packet of a response.
+func strictErr(n int, format string, args ...interface{}) error {
+	return ErrMalformedResponse(fmt.Sprintf("strict: packet %v: %v", n, fmt.Sprintf(format, args...)))
+}
@@ -0,0 +1,94 @@
+package source
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientStrictProtocol(t *testing.T) {
+	tests := []struct {
+		name  string
+		pkts  []*pkt
+		probe []*pkt
+		err   string
+	}{
+		{
+			name: "conformant",
+			pkts: []*pkt{newPkt(responseValue, 0, "part 1, "), newPkt(responseValue, 0, "part 2")},
+		},
+		{
+			name: "type",
+			pkts: []*pkt{newPkt(authResponse, 0, "ok")},
+			err:  "strict: packet 1: type 2, expected 0",
+		},
+		{
+			name: "id",
+			pkts: []*pkt{newPkt(responseValue, 0, "ok"), newPkt(responseValue, 5, "extra")},
+			err:  "strict: packet 2: id",
+		},
+		{
+			name: "response-after-terminator",
+			pkts: []*pkt{newPkt(responseValue, 0, "ok"), newPkt(responseValue, 1, ""), newPkt(responseValue, 0, "late")},
+			err:  "strict: packet 3: response id",
+		},
+		{
+			name: "first-terminator",
+			pkts: []*pkt{newPkt(responseValue, 0, "ok"), newPkt(responseValue, 1, "bad")},
+			err:  `strict: packet 2: terminator body "bad", expected empty`,
+		},
+		{
+			name: "second-terminator",
+			pkts: []*pkt{newPkt(responseValue, 0, "ok"), newPkt(responseValue, 1, ""), newPkt(responseValue, 1, "bad")},
+			err:  `strict: packet 3: terminator body "bad"`,
+		},
+		{
+			name: "trailing",
+			pkts: []*pkt{newPkt(responseValue, 0, "part 1, "), newPkt(responseValue, 0, "part 2")},
+			probe: []*pkt{
+				newPkt(responseValue, 0, ""),
+				newPkt(responseValue, 0, string(responseBody)),
+				newPkt(responseValue, 5, "extra"),
+			},
+			err: "strict: packet 5: unexpected packet after terminator",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newServerStopped(t)
+			if s == nil {
+				return
+			}
+			s.responses[fmt.Sprintf("%v:test", execCommand)] = tc.pkts
+			if tc.probe != nil {
+				s.responses[fmt.Sprintf("%v:", responseValue)] = tc.probe
+			}
+			s.Start()
+			defer func() {
+				assert.NoError(t, s.Close())
+			}()
+
+			c, err := NewClient(s.Addr, Timeout(time.Second*2), StrictProtocol())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() {
+				assert.NoError(t, c.Close())
+			}()
+
+			resp, err := c.Exec("test")
+			if tc.err == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, "part 1, part 2", resp)
+				return
+			}
+			assert.ErrorAs(t, err, new(ErrMalformedResponse))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// subscription streams unsolicited packets received by a Client.
+type subscription struct {
+	c       *Client
+	unsub   string
+	ch      chan string
+	stop    chan struct{}
+	done    chan struct{}
+	flushes chan chan struct{}
+	once    sync.Once
+}
+
+// Subscribe executes cmd, which is expected to subscribe the connection to a
+// stream of messages such as console output, and returns a channel which
+// delivers the body of each packet subsequently received from the server,
+// along with a func which cancels the subscription.
+//
+// The subscription has exclusive use of the connection, so other commands block
+// until it's cancelled. The cancel func must always be called, even if the
+// channel has been closed due to a connection error. If unsubscribe isn't nil
+// cancel executes it once the subscription has stopped, before other commands.
+// Its response and any error are discarded, a failed connection is reported by
+// the next command.
+func (c *Client) Subscribe(cmd, unsubscribe *Cmd) (<-chan string, func(), error) {
+	body, err := c.encode(cmd.String())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var unsub string
+	if unsubscribe != nil {
+		if unsub, err = c.encode(unsubscribe.String()); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if c.dryRun {
+		return nil, nil, ErrDryRun
+	} else if !c.tcp() {
+		return nil, nil, ErrUnsupportedTransport
+	}
+
+	c.mtx.Lock()
+	if _, err := c.execLocked(body); err != nil && !errors.Is(err, ErrPossiblyTruncated) {
+		c.mtx.Unlock()
+		return nil, nil, err
+	}
+
+	s := &subscription{
+		c:       c,
+		unsub:   unsub,
+		ch:      make(chan string),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		flushes: make(chan chan struct{}, 1),
+	}
+	c.smtx.Lock()
+	c.sub = s
+	c.smtx.Unlock()
+	go s.run()
+
+	return s.ch, s.cancel, nil
+}
+
+// run reads packets from the connection and delivers their bodies until
+// cancelled or an error occurs.
+func (s *subscription) run() {
+	defer close(s.done)
+	defer close(s.ch)
+
+	for {
+		// No deadline while idle, cancel sets one to interrupt us.
+		if err := s.c.conn.SetReadDeadline(time.Time{}); err != nil {
+			return
+		}
+
+		select {
+		case <-s.stop:
+			return
+		case req := <-s.flushes:
+			if !s.drain() {
+				return
+			}
+			close(req)
+			continue
+		default:
+		}
+
+		// Wait for the next packet without consuming any of it, so when
+		// cancelled the connection is left at a packet boundary. Flush
+		// interrupts the wait with a deadline.
+		if _, err := s.c.reader.Peek(1); err != nil {
+			if timeout(err) {
+				continue
+			}
+			return
+		}
+
+		if !s.deliver() {
+			return
+		}
+	}
+}
+
+// deliver reads a packet and delivers its body, returning false if the
+// subscription should stop.
+func (s *subscription) deliver() bool {
+	p, err := s.c.readPkt()
+	if err != nil {
+		return false
+	}
+
+	select {
+	case s.ch <- p.Body():
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+// drain delivers the packets already buffered by the client, returning false
+// if the subscription should stop.
+func (s *subscription) drain() bool {
+	for s.c.reader.Buffered() > 0 {
+		if !s.deliver() {
+			return false
+		}
+	}
+	return true
+}
+
+// Flush delivers any packets of the current subscription which have already
+// been received from the server to its channel, returning once they have been
+// received from it, so that none remain to be confused with the responses to
+// subsequent commands. It returns ctx.Err() if ctx is done first, for example
+// because the channel isn't being read. If there's no subscription it's a
+// no-op.
+func (c *Client) Flush(ctx context.Context) error {
+	c.smtx.Lock()
+	s := c.sub
+	c.smtx.Unlock()
+	if s == nil {
+		return nil
+	}
+
+	return s.flush(ctx)
+}
+
+// flush requests the run loop delivers buffered packets and waits for it to
+// do so.
+func (s *subscription) flush(ctx context.Context) error {
+	req := make(chan struct{})
+	select {
+	case s.flushes <- req:
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Interrupt the wait for the next packet, which resets the deadline.
+	s.c.conn.SetReadDeadline(time.Now()) // nolint: errcheck
+
+	select {
+	case <-req:
+		return nil
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// cancel stops the subscription, executes the unsubscribe command if any and
+// releases the connection.
+func (s *subscription) cancel() {
+	s.once.Do(func() {
+		close(s.stop)
+		s.c.conn.SetReadDeadline(time.Now()) // nolint: errcheck
+		<-s.done
+		s.c.smtx.Lock()
+		s.c.sub = nil
+		s.c.smtx.Unlock()
+		if s.unsub != "" {
+			s.c.execLocked(s.unsub) // nolint: errcheck
+		}
+		s.c.mtx.Unlock()
+	})
+}
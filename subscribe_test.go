@@ -0,0 +1,128 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientSubscribe(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:subscribe", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "subscribed"),
+		newPkt(responseValue, 0, "line 1"),
+		newPkt(responseValue, 0, "line 2"),
+	}
+	s.responses[fmt.Sprintf("%v:unsubscribe", execCommand)] = []*pkt{newPkt(responseValue, 0, "unsubscribed")}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var sent bytes.Buffer
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DisableMultiPacket(), WithWiretap(&sent, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	ch, cancel, err := c.Subscribe(NewCmd("subscribe"), NewCmd("unsubscribe"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, expected := range []string{"line 1", "line 2"} {
+		select {
+		case line := <-ch:
+			assert.Equal(t, expected, line)
+		case <-time.After(time.Second * 2):
+			t.Fatal("timeout waiting for", expected)
+		}
+	}
+
+	cancel()
+	cancel()
+
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.Equal(t, 1, bytes.Count(sent.Bytes(), []byte("unsubscribe")))
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
+
+func TestClientSubscribeFlush(t *testing.T) {
+	s := newServerStopped(t)
+	if s == nil {
+		return
+	}
+	s.responses[fmt.Sprintf("%v:subscribe", execCommand)] = []*pkt{
+		newPkt(responseValue, 0, "subscribed"),
+		newPkt(responseValue, 0, "line 1"),
+		newPkt(responseValue, 0, "line 2"),
+		newPkt(responseValue, 0, "line 3"),
+	}
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), DisableMultiPacket())
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	// No subscription.
+	assert.NoError(t, c.Flush(context.Background()))
+
+	ch, cancel, err := c.Subscribe(NewCmd("subscribe"), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The channel isn't being read.
+	ctx, cancelCtx := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancelCtx()
+	assert.ErrorIs(t, c.Flush(ctx), context.DeadlineExceeded)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Flush(context.Background())
+	}()
+
+	for _, expected := range []string{"line 1", "line 2", "line 3"} {
+		select {
+		case line := <-ch:
+			assert.Equal(t, expected, line)
+		case <-time.After(time.Second * 2):
+			t.Fatal("timeout waiting for", expected)
+		}
+	}
+
+	select {
+	case err = <-errc:
+		assert.NoError(t, err)
+	case <-time.After(time.Second * 2):
+		t.Fatal("timeout waiting for flush")
+	}
+
+	cancel()
+	assert.NoError(t, c.Flush(context.Background()))
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+}
@@ -0,0 +1,44 @@
+package source
+
+import (
+	"io"
+	"net"
+)
+
+// tapConn is a net.Conn which copies the bytes sent and received to writers.
+type tapConn struct {
+	net.Conn
+	sent     io.Writer
+	received io.Writer
+}
+
+// WithWiretap copies the raw bytes sent to and received from the server to
+// sent and received respectively, either of which may be nil, for debugging.
+// The tap wraps the connection beneath the client's read buffer, so every byte
+// is observed exactly once, in the order it crossed the connection, regardless
+// of buffering. Errors writing to the tap are ignored.
+func WithWiretap(sent, received io.Writer) func(*Client) error {
+	return func(c *Client) error {
+		c.tapSent = sent
+		c.tapReceived = received
+		return nil
+	}
+}
+
+// Read implements io.Reader.
+func (tc *tapConn) Read(b []byte) (int, error) {
+	n, err := tc.Conn.Read(b)
+	if n > 0 && tc.received != nil {
+		tc.received.Write(b[:n]) // nolint: errcheck
+	}
+	return n, err
+}
+
+// Write implements io.Writer.
+func (tc *tapConn) Write(b []byte) (int, error) {
+	n, err := tc.Conn.Write(b)
+	if n > 0 && tc.sent != nil {
+		tc.sent.Write(b[:n]) // nolint: errcheck
+	}
+	return n, err
+}
@@ -0,0 +1,56 @@
+package source
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithWiretap(t *testing.T) {
+	s := newServer(t)
+	if s == nil {
+		return
+	}
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	var sent, received bytes.Buffer
+	c, err := NewClient(s.Addr, Password(testPassword), WithWiretap(&sent, &received))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "test me", resp)
+
+	encode := func(pkts ...*pkt) []byte {
+		var buf bytes.Buffer
+		for _, p := range pkts {
+			_, err := p.WriteTo(&buf)
+			assert.NoError(t, err)
+		}
+		return buf.Bytes()
+	}
+
+	assert.Equal(t, encode(
+		newPkt(auth, 0, testPassword),
+		newPkt(execCommand, 1, "echo test me"),
+		newPkt(responseValue, 2, ""),
+	), sent.Bytes())
+
+	assert.Equal(t, encode(
+		newPkt(responseValue, 0, ""),
+		newPkt(authResponse, 0, ""),
+		newPkt(responseValue, 1, "test me"),
+		newPkt(responseValue, 2, ""),
+		newPkt(responseValue, 2, string(responseBody)),
+	), received.Bytes())
+}
@@ -0,0 +1,73 @@
+package source
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// WithTLS makes the client connect to the server using TLS configured by
+// config, for servers behind a proxy or hosting panel which requires it. To
+// authenticate using a client certificate, as for mutual TLS, set it in
+// config.Certificates. If config.ServerName isn't set the host of the server
+// address is used. The handshake is bounded by the client timeout and errors
+// from it match ErrTLSHandshake. If a password is set RCON authentication
+// follows the handshake as usual.
+//
+// With TLS 1.3 the server rejects a client certificate after the handshake
+// completes from the point of view of the client, so if no password is set
+// the rejection is reported by the first command instead.
+func WithTLS(config *tls.Config) func(*Client) error {
+	return func(c *Client) error {
+		if config == nil {
+			return ErrNilOption
+		}
+		c.tlsConfig = config
+		return nil
+	}
+}
+
+// authFailed returns the error for the authentication failure err. With TLS
+// 1.3 the server rejects a client certificate after the client completes the
+// handshake, so the rejection is reported to the first read, which is that of
+// authentication, in which case it's reported as a handshake failure.
+func (c *Client) authFailed(err error) error {
+	// Alerts received from the server are reported as remote errors.
+	var opErr *net.OpError
+	if c.tlsConfig != nil && errors.As(err, &opErr) && opErr.Op == "remote error" {
+		return fmt.Errorf("%w %v: %w", ErrTLSHandshake, c.server(), err)
+	}
+
+	return fmt.Errorf("source: auth %v: %w", c.server(), c.ctxErr(err))
+}
+
+// handshakeTLS replaces the connection with a TLS client connection over it
+// and performs the handshake, if TLS is enabled.
+func (c *Client) handshakeTLS(ctx context.Context) error {
+	config := c.tlsConfig
+	if config == nil {
+		return nil
+	} else if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(c.addr)
+		if err != nil {
+			return fmt.Errorf("%w %v: %w", ErrTLSHandshake, c.server(), err)
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	conn := tls.Client(c.conn, config)
+	c.conn = conn
+	if err := conn.SetDeadline(c.now().Add(c.timeout)); err != nil {
+		return err
+	}
+
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return fmt.Errorf("%w %v: %w", ErrTLSHandshake, c.server(), err)
+	}
+
+	return conn.SetDeadline(time.Time{})
+}
@@ -0,0 +1,142 @@
+package source
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testCA is a self-signed certificate authority for TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+// newTestCA returns a new self-signed certificate authority.
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate signed by the CA for the given usage.
+func (ca *testCA) issue(t *testing.T, serial int64, usage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if !assert.NoError(t, err) {
+		return tls.Certificate{}
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if !assert.NoError(t, err) {
+		return tls.Certificate{}
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientWithTLS(t *testing.T) {
+	ca := newTestCA(t)
+	if ca == nil {
+		return
+	}
+
+	l, err := newLocalListener()
+	if !assert.NoError(t, err) {
+		return
+	}
+	l = tls.NewListener(l, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, 2, x509.ExtKeyUsageServerAuth)},
+		ClientCAs:    ca.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})
+	s := newServerListener(t, l)
+	s.requireAuth = true
+	s.Start()
+	defer func() {
+		assert.NoError(t, s.Close())
+	}()
+
+	client := ca.issue(t, 3, x509.ExtKeyUsageClientAuth)
+	c, err := NewClient(s.Addr, Timeout(time.Second*2), Password(testPassword), WithTLS(&tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{client},
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer func() {
+		assert.NoError(t, c.Close())
+	}()
+
+	resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test me", resp)
+
+	// No client certificate.
+	_, err = NewClient(s.Addr, Timeout(time.Second*2), Password(testPassword), WithTLS(&tls.Config{
+		RootCAs: ca.pool,
+	}))
+	assert.ErrorIs(t, err, ErrTLSHandshake)
+
+	// Untrusted server certificate.
+	_, err = NewClient(s.Addr, Timeout(time.Second*2), Password(testPassword), WithTLS(&tls.Config{
+		Certificates: []tls.Certificate{client},
+	}))
+	assert.ErrorIs(t, err, ErrTLSHandshake)
+	assert.NotErrorIs(t, err, ErrAuthFailure)
+
+	// Wrong password.
+	_, err = NewClient(s.Addr, Timeout(time.Second*2), Password("wrong"), WithTLS(&tls.Config{
+		RootCAs:      ca.pool,
+		Certificates: []tls.Certificate{client},
+	}))
+	assert.ErrorIs(t, err, ErrAuthFailure)
+	assert.NotErrorIs(t, err, ErrTLSHandshake)
+
+	_, err = NewClient(s.Addr, WithTLS(nil))
+	assert.ErrorIs(t, err, ErrNilOption)
+}
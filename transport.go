@@ -0,0 +1,123 @@
+package source
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Transport sends and receives rcon packets for a Client, allowing servers to
+// be reached over connections other than the default TCP connection. Packets
+// passed to and returned by a Transport exclude the trailing null terminators
+// of the body.
+type Transport interface {
+	// ReadPacket reads the next packet from the server.
+	ReadPacket() (*Packet, error)
+
+	// WritePacket writes p to the server.
+	WritePacket(p *Packet) error
+
+	// Close closes the transport.
+	Close() error
+}
+
+// deadliner is implemented by Transports which support deadlines.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// WithTransport makes the client use t to talk to the server instead of a TCP
+// connection to the address passed to NewClient. If t implements
+// SetDeadline(time.Time) error the client applies its timeout through it.
+//
+// Features which depend on the TCP connection, such as Reset, Subscribe,
+// ExecBatch, WithWiretap, RecordTo, WithPreamble, WithTLS, WithSocketBuffers
+// and MinecraftFragmentWorkaround, aren't supported and return
+// ErrUnsupportedTransport. Stats doesn't count the bytes read and written by t.
+func WithTransport(t Transport) func(*Client) error {
+	return func(c *Client) error {
+		if t == nil {
+			return ErrNilOption
+		}
+		c.transport = t
+		return nil
+	}
+}
+
+// tcpTransport is the default Transport, which uses the TCP connection of its
+// Client.
+type tcpTransport struct {
+	c *Client
+}
+
+// ReadPacket implements Transport.
+func (t tcpTransport) ReadPacket() (*Packet, error) {
+	p := &pkt{lenient: t.c.lenient}
+	n, err := p.ReadFrom(t.c.reader)
+	atomic.AddUint64(&t.c.stats.BytesRead, uint64(n))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Packet{ID: p.ID, Type: p.Type, Body: p.body}, nil
+}
+
+// WritePacket implements Transport.
+func (t tcpTransport) WritePacket(p *Packet) error {
+	p2 := newPkt(p.Type, p.ID, string(p.Body))
+	if t.c.singleNull {
+		p2 = newSinglePkt(p.Type, p.ID, string(p.Body))
+	}
+
+	var w io.Writer = t.c.conn
+	if t.c.bw != nil {
+		// Buffered by ExecBatch.
+		w = t.c.bw
+	}
+
+	n, err := p2.WriteTo(w)
+	atomic.AddUint64(&t.c.stats.BytesWritten, uint64(n))
+	if n > 0 && n < int64(p2.Size)+4 {
+		// The rest of the packet is missing, so the server would misread
+		// anything written after it.
+		t.c.poisoned = true
+	}
+	return err
+}
+
+// SetDeadline implements deadliner.
+func (t tcpTransport) SetDeadline(d time.Time) error {
+	return t.c.conn.SetDeadline(d)
+}
+
+// Close implements Transport.
+func (t tcpTransport) Close() error {
+	if t.c.stop != nil {
+		close(t.c.stop)
+		t.c.stop = nil
+	}
+	if t.c.conn == nil {
+		return nil
+	}
+	return t.c.conn.Close()
+}
+
+// tcp returns true if the client uses the default TCP transport.
+func (c *Client) tcp() bool {
+	_, ok := c.transport.(tcpTransport)
+	return ok
+}
+
+// checkTransport returns ErrUnsupportedTransport if options which depend on
+// the TCP connection are used with a custom transport.
+func (c *Client) checkTransport() error {
+	if c.tcp() {
+		return nil
+	}
+
+	if c.grace > 0 || c.tapSent != nil || c.tapReceived != nil || c.record != nil || c.preamble != nil || c.tlsConfig != nil || c.readBuf > 0 || c.writeBuf > 0 {
+		return ErrUnsupportedTransport
+	}
+
+	return nil
+}
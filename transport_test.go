@@ -0,0 +1,85 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memTransport is an in memory Transport which replies to packets using the
+// mock server commands.
+type memTransport struct {
+	pending []*Packet
+	closed  bool
+}
+
+func (mt *memTransport) ReadPacket() (*Packet, error) {
+	if mt.closed || len(mt.pending) == 0 {
+		return nil, io.EOF
+	}
+
+	p := mt.pending[0]
+	mt.pending = mt.pending[1:]
+	return p, nil
+}
+
+func (mt *memTransport) WritePacket(p *Packet) error {
+	if mt.closed {
+		return io.ErrClosedPipe
+	}
+
+	resp, ok := commands[fmt.Sprintf("%v:%v", p.Type, string(p.Body))]
+	if !ok {
+		resp = []*pkt{newPkt(responseValue, 0, fmt.Sprintf("unknown command %v:%v", p.Type, string(p.Body)))}
+	}
+	for _, r := range resp {
+		mt.pending = append(mt.pending, &Packet{ID: r.ID + p.ID, Type: r.Type, Body: r.body})
+	}
+	return nil
+}
+
+func (mt *memTransport) Close() error {
+	mt.closed = true
+	return nil
+}
+
+func TestWithTransport(t *testing.T) {
+	for _, multi := range []bool{true, false} {
+		t.Run(fmt.Sprintf("multi-%v", multi), func(t *testing.T) {
+			mt := &memTransport{}
+			opts := []func(*Client) error{WithTransport(mt), Password(testPassword)}
+			if !multi {
+				opts = append(opts, DisableMultiPacket())
+			}
+			c, err := NewClient("unused", opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			resp, err := c.ExecCmd(NewCmd("echo").WithArgs("test me"))
+			assert.NoError(t, err)
+			assert.Equal(t, "test me", resp)
+
+			assert.ErrorIs(t, c.Reset(), ErrUnsupportedTransport)
+
+			_, _, err = c.Subscribe(NewCmd("log"), nil)
+			assert.ErrorIs(t, err, ErrUnsupportedTransport)
+
+			_, err = c.ExecBatch(NewCmd("status"))
+			assert.ErrorIs(t, err, ErrUnsupportedTransport)
+
+			assert.NoError(t, c.Close())
+			assert.True(t, mt.closed)
+		})
+	}
+}
+
+func TestWithTransportUnsupported(t *testing.T) {
+	_, err := NewClient("unused", WithTransport(&memTransport{}), MinecraftFragmentWorkaround())
+	assert.ErrorIs(t, err, ErrUnsupportedTransport)
+
+	_, err = NewClient("unused", WithTransport(nil))
+	assert.ErrorIs(t, err, ErrNilOption)
+}